@@ -0,0 +1,112 @@
+package dggchat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// apiTimeout limits requests made to the http api while opening a connection.
+const apiTimeout = 10 * time.Second
+
+type meResponse struct {
+	Nick     string   `json:"nick"`
+	Features []string `json:"features"`
+}
+
+// SetAPIURL changes the base url used for requests to the destinygg http api,
+// for example when looking up the user the session is logged in as.
+// This should be done before calling *session.Open()
+func (s *Session) SetAPIURL(u url.URL) {
+	s.Lock()
+	defer s.Unlock()
+	s.backend.APIURL = u
+	s.apiURLSet = true
+}
+
+// apiTrusted reports whether the login key may be sent to the http api. This is the case if
+// the api is on the host of the chat, or if it was set explicitly. Otherwise changing the chat
+// url would send the login key to the api of the default backend.
+// call with locks held
+func (s *Session) apiTrusted() bool {
+	return s.apiURLSet || s.backend.APIURL.Host == s.backend.URL.Host
+}
+
+// newAPIRequest creates a request to the http api, path may contain escaped parts.
+// call with locks held
+func (s *Session) newAPIRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	u := s.backend.APIURL
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return nil, err
+	}
+	u.Path, u.RawPath = unescaped, path
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	if !s.readOnly && s.apiTrusted() {
+		req.Header.Add("Cookie", s.authCookie())
+	}
+	return req, nil
+}
+
+func (s *Session) doAPIRequest(req *http.Request, v interface{}) error {
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{status: resp.StatusCode, path: req.URL.Path}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// statusError is returned for unsuccessful responses of the http api
+type statusError struct {
+	status int
+	path   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s from %s", e.status, http.StatusText(e.status), e.path)
+}
+
+// fetchMe looks up the user belonging to the login key.
+// Returns ErrAuthFailed if the api answers without a user, as it does for anonymous requests.
+// Other unsuccessful responses, e.g. a 403 from a proxy in front of the api, return a statusError.
+// The session lock is only held while building the request.
+func (s *Session) fetchMe(ctx context.Context) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+
+	s.RLock()
+	req, err := s.newAPIRequest(ctx, http.MethodGet, "/api/chat/me", nil)
+	s.RUnlock()
+	if err != nil {
+		return User{}, err
+	}
+
+	var me meResponse
+	if err := s.doAPIRequest(req, &me); err != nil {
+		return User{}, err
+	}
+	if me.Nick == "" {
+		return User{}, ErrAuthFailed
+	}
+
+	return User{Nick: me.Nick, Features: me.Features}, nil
+}
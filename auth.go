@@ -0,0 +1,67 @@
+package dggchat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAuthFailed is thrown when the http api does not know the user of the login key or session cookie,
+// and would treat the session as anonymous. Reconnecting stops when it is encountered.
+var ErrAuthFailed = errors.New("authentication failed, the login key or session cookie is invalid")
+
+// SetSessionCookie logs the session in with the cookies of a website login instead of a login key.
+// rememberme is optional, it allows the server to create a new sid when the old one expired.
+// This should be done before calling *session.Open()
+func (s *Session) SetSessionCookie(sid string, rememberme string) {
+	s.Lock()
+	defer s.Unlock()
+	s.sid = sid
+	s.rememberMe = rememberme
+	s.readOnly = false
+}
+
+// WithSessionCookie logs the session in with the cookies of a website login, see *session.SetSessionCookie()
+func WithSessionCookie(sid string, rememberme string) Option {
+	return func(s *Session) {
+		s.SetSessionCookie(sid, rememberme)
+	}
+}
+
+// Validate checks the login key or session cookie with the http api before connecting,
+// and returns the user the session is logged in as.
+// Returns ErrAuthFailed if they are not accepted, and ErrReadOnly for read-only sessions.
+// Other errors, e.g. an unsuccessful response of the api, leave it unknown whether they are valid.
+func (s *Session) Validate(ctx context.Context) (User, error) {
+	s.RLock()
+	readOnly := s.readOnly
+	s.RUnlock()
+	if readOnly {
+		return User{}, ErrReadOnly
+	}
+
+	me, err := s.fetchMe(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	s.state.setMe(me)
+	return me, nil
+}
+
+// authCookie returns the cookie header value used to log in.
+// call with locks held
+func (s *Session) authCookie() string {
+	if s.sid != "" {
+		cookie := fmt.Sprintf("sid=%s", s.sid)
+		if s.rememberMe != "" {
+			cookie += fmt.Sprintf("; rememberme=%s", s.rememberMe)
+		}
+		return cookie
+	}
+
+	name := s.backend.CookieName
+	if name == "" {
+		name = DestinyGG.CookieName
+	}
+	return fmt.Sprintf("%s=%s", name, s.loginKey)
+}
@@ -0,0 +1,264 @@
+package dggchat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestValidate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Cookie") {
+		case "sid=good; rememberme=token", "authtoken=good":
+			_, _ = w.Write([]byte(`{"nick":"alice","features":["moderator"]}`))
+		case "authtoken=anonymous", "sid=bad":
+			_, _ = w.Write([]byte(`{}`))
+		case "authtoken=blocked":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	tests := []struct {
+		name   string
+		opt    Option
+		err    error
+		status int
+	}{
+		{"session cookie", WithSessionCookie("good", "token"), nil, 0},
+		{"login key", WithLoginKey("good"), nil, 0},
+		{"invalid session cookie", WithSessionCookie("bad", ""), ErrAuthFailed, 0},
+		{"anonymous", WithLoginKey("anonymous"), ErrAuthFailed, 0},
+		{"forbidden", WithLoginKey("blocked"), nil, http.StatusForbidden},
+		{"read-only", func(*Session) {}, ErrReadOnly, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := NewWithOptions(tt.opt)
+			s.SetAPIURL(*u)
+
+			me, err := s.Validate(context.Background())
+			if tt.status != 0 {
+				var se *statusError
+				if !errors.As(err, &se) || se.status != tt.status {
+					t.Fatalf("expected status %d, got %v", tt.status, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if me.Nick != "alice" || !me.IsMod() {
+				t.Errorf("unexpected user %+v", me)
+			}
+			if own, _ := s.Me(); own.Nick != "alice" {
+				t.Errorf("expected own user to be set, got %+v", own)
+			}
+		})
+	}
+
+	s, _ := New("anonymous")
+	s.SetAPIURL(*u)
+	if err := s.Open(); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("expected Open to fail with ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestOpenLooksUpUserWithoutLock(t *testing.T) {
+	requested := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-release
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	s, _ := New("key")
+	s.SetAPIURL(*u)
+
+	opened := make(chan error, 1)
+	go func() { opened <- s.Open() }()
+	<-requested
+
+	locked := make(chan struct{})
+	go func() {
+		s.SetMentionKeywords("pepelaugh")
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the session not to be locked while looking up our user")
+	}
+
+	close(release)
+	if err := <-opened; !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+type reconnectObserver struct {
+	errs chan error
+}
+
+func (o *reconnectObserver) ObserveSend(string, error)            {}
+func (o *reconnectObserver) ObserveHandler(string, time.Duration) {}
+func (o *reconnectObserver) ObserveReconnect(err error)           { o.errs <- err }
+
+func TestReconnectStopsOnAuthFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	s, _ := New("revoked")
+	s.SetAPIURL(*u)
+	s.state.setMe(User{Nick: "bot"})
+	o := &reconnectObserver{errs: make(chan error, 10)}
+	s.SetObserver(o)
+
+	done := make(chan struct{})
+	go func() {
+		s.reconnect()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected reconnecting to stop")
+	}
+	if len(o.errs) != 1 {
+		t.Fatalf("expected a single reconnect attempt, got %d", len(o.errs))
+	}
+	if err := <-o.errs; !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestLoginKeyStaysOnChatHost(t *testing.T) {
+	t.Setenv("CUSTOM_WSHOST", "chat.example.com")
+	s, _ := New("key")
+	if u := s.Backend().APIURL; u.String() != "https://chat.example.com" {
+		t.Errorf("expected the api url to follow CUSTOM_WSHOST, got %q", u.String())
+	}
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"nick":"alice"}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	tests := []struct {
+		name     string
+		setup    func(s *Session)
+		requests int32
+	}{
+		{"other chat host", func(s *Session) { s.SetURL(url.URL{Scheme: "wss", Host: "chat.example.com", Path: "/ws"}) }, 0},
+		{"same host", func(s *Session) { s.SetURL(url.URL{Scheme: "ws", Host: u.Host, Path: "/ws"}) }, 1},
+		{"explicit api url", func(s *Session) { s.SetAPIURL(*u) }, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			s, _ := NewWithOptions(WithLoginKey("key"))
+			s.backend.APIURL = *u
+			tt.setup(s)
+
+			if err := s.lookupMe(false); err != nil {
+				t.Fatal(err)
+			}
+			if n := requests.Load(); n != tt.requests {
+				t.Errorf("expected %d requests, got %d", tt.requests, n)
+			}
+			_, ok := s.Me()
+			if ok != (tt.requests > 0) {
+				t.Errorf("unexpected own user lookup %v", ok)
+			}
+		})
+	}
+}
+
+func TestReconnectContinuesOnLookupFailure(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusBadGateway} {
+		status := status
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			t.Parallel()
+
+			var lookups, dials atomic.Int32
+			var upgrader websocket.Upgrader
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/chat/me" {
+					lookups.Add(1)
+					http.Error(w, http.StatusText(status), status)
+					return
+				}
+				// the first attempt fails, so reconnecting has to back off and retry
+				if dials.Add(1) == 1 {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				ws, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer ws.Close()
+				for {
+					if _, _, err := ws.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}))
+			defer srv.Close()
+			u, _ := url.Parse(srv.URL)
+			u.Scheme, u.Path = "ws", "/ws"
+
+			s, _ := NewWithOptions(WithLoginKey("key"), WithBackend(ChatGo(*u)))
+			o := &reconnectObserver{errs: make(chan error, 10)}
+			s.SetObserver(o)
+
+			done := make(chan struct{})
+			go func() {
+				s.reconnect()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("expected reconnecting to succeed")
+			}
+			defer s.Close()
+
+			if len(o.errs) != 2 {
+				t.Fatalf("expected two reconnect attempts, got %d", len(o.errs))
+			}
+			var de *DialError
+			if err := <-o.errs; !errors.As(err, &de) {
+				t.Errorf("expected the first attempt to fail dialing, got %v", err)
+			}
+			if err := <-o.errs; err != nil {
+				t.Errorf("expected the second attempt to succeed, got %v", err)
+			}
+			if n := lookups.Load(); n != 2 {
+				t.Errorf("expected the user to be looked up on every attempt, got %d lookups", n)
+			}
+		})
+	}
+}
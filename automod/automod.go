@@ -0,0 +1,165 @@
+// Package automod automatically mutes users whose chat messages break configurable rules,
+// such as spamming the same message, excessive caps, emote spam, links or banned phrases.
+package automod
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// DefaultPunishments are used when a config does not specify any punishments
+var DefaultPunishments = []time.Duration{
+	time.Minute,
+	10 * time.Minute,
+	time.Hour,
+}
+
+// DefaultOffenseExpiry is used when a config does not specify how long offenses are remembered
+const DefaultOffenseExpiry = 24 * time.Hour
+
+// Config configures the behaviour of an Automod
+type Config struct {
+	// Rules are checked in order, the first violated rule is punished
+	Rules []Rule
+	// Punishments are the mute durations for the first, second, ... offense of a user.
+	// Further offenses use the last duration.
+	Punishments []time.Duration
+	// OffenseExpiry is the time after which a user's previous offenses are forgotten
+	OffenseExpiry time.Duration
+	// ExemptFeatures lists features that exempt a user from all rules, e.g. dggchat.FeatureModerator
+	ExemptFeatures []string
+	// DryRun only reports what would be done, without muting anyone
+	DryRun bool
+	// OnAction is called for every violation, after the user was muted or would have been in dry-run mode
+	OnAction func(Report)
+}
+
+// Violation describes a broken rule
+type Violation struct {
+	Rule   string
+	Reason string
+}
+
+// Report describes the action taken for a violation
+type Report struct {
+	Message   dggchat.Message
+	Violation Violation
+	// Offense is the number of the user's offense, starting at 1
+	Offense  int
+	Duration time.Duration
+	DryRun   bool
+	// Err is set if sending the mute failed
+	Err error
+}
+
+type offenses struct {
+	count int
+	last  time.Time
+}
+
+// Automod checks chat messages against rules and mutes offenders
+type Automod struct {
+	sync.Mutex
+	config   Config
+	history  *History
+	offenses map[string]*offenses
+	now      func() time.Time
+}
+
+// New creates an automod with the given config
+func New(c Config) *Automod {
+	if len(c.Punishments) == 0 {
+		c.Punishments = DefaultPunishments
+	}
+	if c.OffenseExpiry <= 0 {
+		c.OffenseExpiry = DefaultOffenseExpiry
+	}
+	return &Automod{
+		config:   c,
+		history:  newHistory(),
+		offenses: make(map[string]*offenses),
+		now:      time.Now,
+	}
+}
+
+// HandleMessage checks a chat message and mutes the sender if a rule is violated.
+// It can be passed to *session.AddMessageHandler(). Messages replayed from the chat history are ignored.
+func (a *Automod) HandleMessage(m dggchat.Message, s *dggchat.Session) {
+	if m.Historical {
+		return
+	}
+	if me, ok := s.Me(); ok && strings.EqualFold(me.Nick, m.Sender.Nick) {
+		return
+	}
+
+	v, ok := a.Check(m)
+	if !ok {
+		return
+	}
+
+	r := a.punish(m, v)
+	if !r.DryRun {
+		r.Err = s.SendMute(m.Sender.Nick, r.Duration)
+	}
+	if a.config.OnAction != nil {
+		a.config.OnAction(r)
+	}
+}
+
+// Check records the message and returns the first rule it violates.
+// If the message does not violate any rule, false is returned as the second parameter.
+func (a *Automod) Check(m dggchat.Message) (Violation, bool) {
+	defer a.history.add(m)
+
+	if a.exempt(m.Sender) {
+		return Violation{}, false
+	}
+
+	for _, rule := range a.config.Rules {
+		if reason, violated := rule.Check(m, a.history); violated {
+			return Violation{Rule: rule.Name(), Reason: reason}, true
+		}
+	}
+	return Violation{}, false
+}
+
+func (a *Automod) exempt(u dggchat.User) bool {
+	for _, feature := range a.config.ExemptFeatures {
+		if u.HasFeature(feature) {
+			return true
+		}
+	}
+	return false
+}
+
+// punish counts the offense and returns the resulting report
+func (a *Automod) punish(m dggchat.Message, v Violation) Report {
+	a.Lock()
+	defer a.Unlock()
+
+	now := a.now()
+	nick := strings.ToLower(m.Sender.Nick)
+	o, ok := a.offenses[nick]
+	if !ok || now.Sub(o.last) > a.config.OffenseExpiry {
+		o = &offenses{}
+		a.offenses[nick] = o
+	}
+	o.count++
+	o.last = now
+
+	i := o.count - 1
+	if i >= len(a.config.Punishments) {
+		i = len(a.config.Punishments) - 1
+	}
+
+	return Report{
+		Message:   m,
+		Violation: v,
+		Offense:   o.count,
+		Duration:  a.config.Punishments[i],
+		DryRun:    a.config.DryRun,
+	}
+}
@@ -0,0 +1,50 @@
+package automod
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestHandleMessage(t *testing.T) {
+	replayed := msg("alice", "buy gold", 0)
+	replayed.Historical = true
+	mod := msg("mod", "buy gold", 0)
+	mod.Sender.Features = []string{dggchat.FeatureModerator}
+
+	tests := []struct {
+		name     string
+		messages []dggchat.Message
+		// offenses are the offense numbers reported, in order
+		offenses []int
+	}{
+		{"no violation", []dggchat.Message{msg("alice", "hello", 0)}, nil},
+		{"violation", []dggchat.Message{msg("alice", "buy gold", 0)}, []int{1}},
+		{"repeated offense", []dggchat.Message{msg("alice", "buy gold", 0), msg("alice", "buy gold", time.Second)}, []int{1, 2}},
+		{"other users", []dggchat.Message{msg("alice", "buy gold", 0), msg("bob", "buy gold", time.Second)}, []int{1, 1}},
+		{"history ignored", []dggchat.Message{replayed, msg("alice", "buy gold", time.Second)}, []int{1}},
+		{"exempt", []dggchat.Message{mod}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := dggchat.New()
+			rule, _ := NewPhraseRule("gold")
+			var offenses []int
+			a := New(Config{
+				Rules:          []Rule{rule},
+				ExemptFeatures: []string{dggchat.FeatureModerator},
+				DryRun:         true,
+				OnAction:       func(r Report) { offenses = append(offenses, r.Offense) },
+			})
+
+			for _, m := range tt.messages {
+				a.HandleMessage(m, s)
+			}
+			if !reflect.DeepEqual(offenses, tt.offenses) {
+				t.Errorf("expected offenses %v, got %v", tt.offenses, offenses)
+			}
+		})
+	}
+}
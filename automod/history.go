@@ -0,0 +1,51 @@
+package automod
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// historySize is the number of recent messages remembered per user
+const historySize = 20
+
+// History holds the recent messages of every user, for rules that look at more than one message
+type History struct {
+	sync.RWMutex
+	messages map[string][]dggchat.Message
+}
+
+func newHistory() *History {
+	return &History{
+		messages: make(map[string][]dggchat.Message),
+	}
+}
+
+func (h *History) add(m dggchat.Message) {
+	h.Lock()
+	defer h.Unlock()
+
+	nick := strings.ToLower(m.Sender.Nick)
+	messages := append(h.messages[nick], m)
+	if len(messages) > historySize {
+		messages = messages[len(messages)-historySize:]
+	}
+	h.messages[nick] = messages
+}
+
+// Recent returns the messages of the user sent after since, oldest first.
+// The message currently being checked is not included.
+func (h *History) Recent(nick string, since time.Time) []dggchat.Message {
+	h.RLock()
+	defer h.RUnlock()
+
+	var recent []dggchat.Message
+	for _, m := range h.messages[strings.ToLower(nick)] {
+		if m.Timestamp.After(since) {
+			recent = append(recent, m)
+		}
+	}
+	return recent
+}
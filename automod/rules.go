@@ -0,0 +1,221 @@
+package automod
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// Rule checks a single chat message
+type Rule interface {
+	// Name identifies the rule in reports
+	Name() string
+	// Check returns a reason and true if the message violates the rule
+	Check(m dggchat.Message, h *History) (string, bool)
+}
+
+// RepeatRule is violated when a user sends the same message Count times within Window.
+// A Count below 2 disables the rule.
+type RepeatRule struct {
+	Count  int
+	Window time.Duration
+}
+
+// Name implements Rule
+func (r RepeatRule) Name() string { return "repeat" }
+
+// Check implements Rule
+func (r RepeatRule) Check(m dggchat.Message, h *History) (string, bool) {
+	if r.Count < 2 {
+		return "", false
+	}
+	count := 1
+	for _, previous := range h.Recent(m.Sender.Nick, m.Timestamp.Add(-r.Window)) {
+		if strings.EqualFold(strings.TrimSpace(previous.Message), strings.TrimSpace(m.Message)) {
+			count++
+		}
+	}
+	if count >= r.Count {
+		return fmt.Sprintf("repeated message %d times", count), true
+	}
+	return "", false
+}
+
+// CapsRule is violated when more than MaxRatio of the letters in a message
+// of at least MinLetters letters are upper case
+type CapsRule struct {
+	MinLetters int
+	MaxRatio   float64
+}
+
+// Name implements Rule
+func (r CapsRule) Name() string { return "caps" }
+
+// Check implements Rule
+func (r CapsRule) Check(m dggchat.Message, _ *History) (string, bool) {
+	letters, upper := 0, 0
+	for _, c := range m.Message {
+		if unicode.IsLetter(c) {
+			letters++
+			if unicode.IsUpper(c) {
+				upper++
+			}
+		}
+	}
+	if letters == 0 || letters < r.MinLetters {
+		return "", false
+	}
+	ratio := float64(upper) / float64(letters)
+	if ratio > r.MaxRatio {
+		return fmt.Sprintf("%.0f%% caps", ratio*100), true
+	}
+	return "", false
+}
+
+// EmoteRule is violated when a message contains more than Max emotes
+type EmoteRule struct {
+	// Emotes is the list of emote names, they are matched as whole words
+	Emotes []string
+	Max    int
+}
+
+// Name implements Rule
+func (r EmoteRule) Name() string { return "emotes" }
+
+// Check implements Rule
+func (r EmoteRule) Check(m dggchat.Message, _ *History) (string, bool) {
+	count := 0
+	for _, word := range strings.Fields(m.Message) {
+		// emote modifiers are appended with colons, e.g. "PepeLaugh:wide"
+		word = strings.SplitN(word, ":", 2)[0]
+		for _, emote := range r.Emotes {
+			if word == emote {
+				count++
+				break
+			}
+		}
+	}
+	if count > r.Max {
+		return fmt.Sprintf("%d emotes", count), true
+	}
+	return "", false
+}
+
+// linkTLDs are the top level domains of links written without scheme or "www.",
+// other words containing dots like "file.go" are not considered links
+var linkTLDs = []string{
+	"com", "net", "org", "gg", "tv", "io", "me", "co", "ly", "be", "to", "xyz", "info",
+	"live", "link", "site", "online", "app", "dev", "uk", "de", "ru",
+}
+
+var linkRegexp = regexp.MustCompile(`(?i)\b(?:https?://\S+|www\.\S+|(?:[a-z0-9-]+\.)+(?:` +
+	strings.Join(linkTLDs, "|") + `)\b(?:/\S*)?)`)
+
+// LinkRule is violated when a message contains a link to a host that is not allowed.
+// Links are recognized by their scheme, a "www." prefix or a common top level domain.
+type LinkRule struct {
+	// Allowed lists hosts that may be linked, including their subdomains
+	Allowed []string
+}
+
+// Name implements Rule
+func (r LinkRule) Name() string { return "link" }
+
+// Check implements Rule
+func (r LinkRule) Check(m dggchat.Message, _ *History) (string, bool) {
+	for _, link := range linkRegexp.FindAllString(m.Message, -1) {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		if !r.allowed(strings.ToLower(u.Hostname())) {
+			return fmt.Sprintf("link to %s", u.Hostname()), true
+		}
+	}
+	return "", false
+}
+
+func (r LinkRule) allowed(host string) bool {
+	for _, allowed := range r.Allowed {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// PhraseRule is violated when a message matches one of the banned phrases
+type PhraseRule struct {
+	Phrases []*regexp.Regexp
+	// sources are the phrases given to NewPhraseRule, shown in reasons instead of the expressions
+	sources []string
+}
+
+// NewPhraseRule compiles the given regular expressions into a case insensitive PhraseRule
+func NewPhraseRule(phrases ...string) (PhraseRule, error) {
+	r := PhraseRule{}
+	for _, phrase := range phrases {
+		re, err := regexp.Compile("(?i)" + phrase)
+		if err != nil {
+			return PhraseRule{}, err
+		}
+		r.Phrases = append(r.Phrases, re)
+		r.sources = append(r.sources, phrase)
+	}
+	return r, nil
+}
+
+// Name implements Rule
+func (r PhraseRule) Name() string { return "phrase" }
+
+// Check implements Rule
+func (r PhraseRule) Check(m dggchat.Message, _ *History) (string, bool) {
+	for i, re := range r.Phrases {
+		if !re.MatchString(m.Message) {
+			continue
+		}
+		phrase := re.String()
+		if i < len(r.sources) {
+			phrase = r.sources[i]
+		}
+		return fmt.Sprintf("banned phrase %q", phrase), true
+	}
+	return "", false
+}
+
+// NewAccountRule applies Rule only to accounts younger than MinAge.
+// If Rule is nil, every message of such accounts is a violation.
+// Users without a known creation date are never considered new.
+type NewAccountRule struct {
+	MinAge time.Duration
+	Rule   Rule
+}
+
+// Name implements Rule
+func (r NewAccountRule) Name() string {
+	if r.Rule == nil {
+		return "new account"
+	}
+	return "new account " + r.Rule.Name()
+}
+
+// Check implements Rule
+func (r NewAccountRule) Check(m dggchat.Message, h *History) (string, bool) {
+	created := m.Sender.CreatedDate
+	if created.IsZero() || m.Timestamp.Sub(created) >= r.MinAge {
+		return "", false
+	}
+	if r.Rule == nil {
+		return "account too new", true
+	}
+	return r.Rule.Check(m, h)
+}
@@ -0,0 +1,137 @@
+package automod
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func msg(nick string, text string, at time.Duration) dggchat.Message {
+	return dggchat.Message{Sender: dggchat.User{Nick: nick}, Message: text, Timestamp: start.Add(at)}
+}
+
+type ruleTest struct {
+	name     string
+	previous []dggchat.Message
+	message  dggchat.Message
+	violated bool
+}
+
+func runRuleTests(t *testing.T, rule Rule, tests []ruleTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory()
+			for _, m := range tt.previous {
+				h.add(m)
+			}
+			reason, violated := rule.Check(tt.message, h)
+			if violated != tt.violated {
+				t.Errorf("%s(%q) = %v (%q), want %v", rule.Name(), tt.message.Message, violated, reason, tt.violated)
+			}
+			if violated && reason == "" {
+				t.Error("expected a reason for the violation")
+			}
+		})
+	}
+}
+
+func TestRepeatRule(t *testing.T) {
+	runRuleTests(t, RepeatRule{Count: 3, Window: time.Minute}, []ruleTest{
+		{"first message", nil, msg("alice", "hi", 0), false},
+		{"below count", []dggchat.Message{msg("alice", "hi", 0)}, msg("alice", "hi", time.Second), false},
+		{"at count", []dggchat.Message{msg("alice", "hi", 0), msg("alice", "HI ", time.Second)}, msg("alice", "hi", 2*time.Second), true},
+		{"other messages", []dggchat.Message{msg("alice", "hi", 0), msg("alice", "yo", time.Second)}, msg("alice", "hi", 2*time.Second), false},
+		{"other users", []dggchat.Message{msg("bob", "hi", 0), msg("bob", "hi", time.Second)}, msg("alice", "hi", 2*time.Second), false},
+		{"outside window", []dggchat.Message{msg("alice", "hi", 0), msg("alice", "hi", time.Second)}, msg("alice", "hi", 2*time.Minute), false},
+	})
+	runRuleTests(t, RepeatRule{}, []ruleTest{
+		{"disabled", nil, msg("alice", "hi", 0), false},
+		{"disabled with history", []dggchat.Message{msg("alice", "hi", 0)}, msg("alice", "hi", time.Second), false},
+	})
+}
+
+func TestCapsRule(t *testing.T) {
+	runRuleTests(t, CapsRule{MinLetters: 5, MaxRatio: 0.5}, []ruleTest{
+		{"lower case", nil, msg("alice", "hello there", 0), false},
+		{"upper case", nil, msg("alice", "HELLO THERE", 0), true},
+		{"too short", nil, msg("alice", "HEY", 0), false},
+		{"above ratio", nil, msg("alice", "HELlo", 0), true},
+		{"below ratio", nil, msg("alice", "HElloo", 0), false},
+		{"ignores non letters", nil, msg("alice", "HEY 123 !!!", 0), false},
+		{"no letters", nil, msg("alice", "12345 !!!", 0), false},
+	})
+}
+
+func TestEmoteRule(t *testing.T) {
+	runRuleTests(t, EmoteRule{Emotes: []string{"PepeLaugh", "OMEGALUL"}, Max: 2}, []ruleTest{
+		{"no emotes", nil, msg("alice", "hello", 0), false},
+		{"at max", nil, msg("alice", "PepeLaugh OMEGALUL", 0), false},
+		{"above max", nil, msg("alice", "PepeLaugh PepeLaugh OMEGALUL", 0), true},
+		{"modifiers", nil, msg("alice", "PepeLaugh:wide PepeLaugh:flip OMEGALUL", 0), true},
+		{"whole words only", nil, msg("alice", "PepeLaughs PepeLaughs PepeLaughs", 0), false},
+		{"case sensitive", nil, msg("alice", "pepelaugh pepelaugh pepelaugh", 0), false},
+	})
+}
+
+func TestLinkRule(t *testing.T) {
+	runRuleTests(t, LinkRule{Allowed: []string{"destiny.gg", "youtube.com"}}, []ruleTest{
+		{"no link", nil, msg("alice", "hello there", 0), false},
+		{"allowed", nil, msg("alice", "https://www.destiny.gg/bigscreen", 0), false},
+		{"allowed subdomain", nil, msg("alice", "m.youtube.com/watch?v=1", 0), false},
+		{"allowed ignoring case", nil, msg("alice", "DESTINY.GG", 0), false},
+		{"scheme", nil, msg("alice", "look https://example.org/x", 0), true},
+		{"www", nil, msg("alice", "www.example.ninja", 0), true},
+		{"known tld", nil, msg("alice", "go to example.com now", 0), true},
+		{"suffix of allowed host", nil, msg("alice", "notdestiny.gg", 0), true},
+		{"file name", nil, msg("alice", "see main.go and rules.py", 0), false},
+		{"abbreviation", nil, msg("alice", "e.g. i.e. etc.", 0), false},
+		{"version", nil, msg("alice", "go1.21.5 released", 0), false},
+		{"second link", nil, msg("alice", "destiny.gg and example.net", 0), true},
+	})
+}
+
+func TestPhraseRule(t *testing.T) {
+	rule, err := NewPhraseRule("buy gold", `free\s+\w+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runRuleTests(t, rule, []ruleTest{
+		{"no phrase", nil, msg("alice", "hello", 0), false},
+		{"phrase", nil, msg("alice", "please BUY GOLD here", 0), true},
+		{"expression", nil, msg("alice", "get free   stuff", 0), true},
+	})
+
+	if reason, _ := rule.Check(msg("alice", "buy gold", 0), nil); reason != `banned phrase "buy gold"` {
+		t.Errorf("expected the phrase as reason, got %q", reason)
+	}
+	if _, err := NewPhraseRule("("); err == nil {
+		t.Error("expected invalid expressions to be rejected")
+	}
+	if _, violated := (PhraseRule{Phrases: []*regexp.Regexp{regexp.MustCompile("gold")}}).Check(msg("alice", "GOLD", 0), nil); violated {
+		t.Error("expected phrases not created with NewPhraseRule to be case sensitive")
+	}
+}
+
+func TestNewAccountRule(t *testing.T) {
+	young := msg("alice", "hi", 0)
+	young.Sender.CreatedDate = start.Add(-time.Hour)
+	old := msg("bob", "hi", 0)
+	old.Sender.CreatedDate = start.Add(-48 * time.Hour)
+	youngCaps := msg("alice", "HELLO THERE", 0)
+	youngCaps.Sender.CreatedDate = start.Add(-time.Hour)
+
+	runRuleTests(t, NewAccountRule{MinAge: 24 * time.Hour}, []ruleTest{
+		{"young account", nil, young, true},
+		{"old account", nil, old, false},
+		{"unknown creation date", nil, msg("carol", "hi", 0), false},
+	})
+	runRuleTests(t, NewAccountRule{MinAge: 24 * time.Hour, Rule: CapsRule{MinLetters: 5, MaxRatio: 0.5}}, []ruleTest{
+		{"young account within rule", nil, young, false},
+		{"young account breaking rule", nil, youngCaps, true},
+	})
+}
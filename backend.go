@@ -0,0 +1,149 @@
+package dggchat
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrUnsupported is thrown when attempting to send a message type the backend does not support
+var ErrUnsupported = errors.New("message type not supported by the chat backend")
+
+// A Backend describes a chat server speaking the destinygg chat protocol, e.g. destiny.gg,
+// strims.gg or a self-hosted chat-go instance.
+type Backend struct {
+	Name string
+	// URL is the websocket url of the chat
+	URL url.URL
+	// APIURL is the base url of the http api
+	APIURL url.URL
+	// Origin is sent as origin header when connecting, if set
+	Origin string
+	// CookieName is the name of the cookie the login key is sent as
+	CookieName string
+	// Events lists the message types supported by the backend, nil means all types are supported.
+	// Sending a message of an unsupported type returns ErrUnsupported.
+	Events []string
+	// Flairs describes the features of users shown as flairs
+	Flairs []Flair
+}
+
+// A Flair describes a user feature
+type Flair struct {
+	Feature string
+	Name    string
+}
+
+// flairs used by every backend
+var commonFlairs = []Flair{
+	{FeatureAdministrator, "Administrator"},
+	{FeatureModerator, "Moderator"},
+	{FeatureProtected, "Protected"},
+	{FeatureVIP, "VIP"},
+	{FeatureSubscriber, "Subscriber"},
+	{FeatureBot, "Bot"},
+}
+
+// DestinyGG is the destiny.gg chat
+var DestinyGG = Backend{
+	Name:       "destiny.gg",
+	URL:        url.URL{Scheme: "wss", Host: "www.destiny.gg", Path: "/ws"},
+	APIURL:     url.URL{Scheme: "https", Host: "www.destiny.gg"},
+	CookieName: "authtoken",
+	Flairs: append([]Flair{
+		{FeatureTier1, "Subscriber Tier 1"},
+		{FeatureTier2, "Subscriber Tier 2"},
+		{FeatureNotable, "Notable"},
+		{FeatureTier3, "Subscriber Tier 3"},
+		{FeatureTrusted, "Trusted"},
+		{FeatureContributor, "Contributor"},
+		{FeatureCompChallenge, "Compchallenge"},
+		{FeatureEve, "Eve"},
+		{FeatureTier4, "Subscriber Tier 4"},
+		{FeatureTwitch, "Twitch"},
+		{FeatureSC2, "Starcraft 2"},
+		{FeatureBot2, "Bot"},
+		{FeatureBroadcaster, "Broadcaster"},
+		{FeatureBirthday, "Birthday"},
+	}, commonFlairs...),
+}
+
+// Strims is the strims.gg chat
+var Strims = Backend{
+	Name:       "strims.gg",
+	URL:        url.URL{Scheme: "wss", Host: "chat.strims.gg", Path: "/ws"},
+	APIURL:     url.URL{Scheme: "https", Host: "strims.gg"},
+	Origin:     "https://strims.gg",
+	CookieName: "jwt",
+	Events: []string{
+		"MSG", "PRIVMSG", "PRIVMSGSENT", "NAMES", "JOIN", "QUIT", "UPDATEUSER",
+		"MUTE", "UNMUTE", "BAN", "UNBAN", "SUBONLY", "BROADCAST",
+		"PING", "PONG", "ERR", "REFRESH", "VIEWERSTATE",
+	},
+	Flairs: commonFlairs,
+}
+
+// ChatGo returns the backend of a self-hosted chat-go instance with the given websocket url.
+// The http api is expected on the same host.
+func ChatGo(u url.URL) Backend {
+	api := url.URL{Scheme: "https", Host: u.Host}
+	if u.Scheme == "ws" {
+		api.Scheme = "http"
+	}
+	return Backend{
+		Name:       u.Host,
+		URL:        u,
+		APIURL:     api,
+		CookieName: "authtoken",
+		Flairs:     commonFlairs,
+	}
+}
+
+// Supports returns true if the backend supports the message type
+func (b Backend) Supports(mType string) bool {
+	if b.Events == nil {
+		return true
+	}
+	for _, e := range b.Events {
+		if strings.EqualFold(e, mType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flair returns the description of the feature.
+// If the feature is unknown, false is returned as the second parameter.
+func (b Backend) Flair(feature string) (Flair, bool) {
+	for _, f := range b.Flairs {
+		if f.Feature == feature {
+			return f, true
+		}
+	}
+	return Flair{}, false
+}
+
+// SetBackend changes the chat server the session connects to.
+// The backend is used as is, overrides of the CUSTOM_WSHOST and CUSTOM_ORIGINHEADER
+// environment variables are discarded, see New().
+// This should be done before calling *session.Open()
+func (s *Session) SetBackend(b Backend) {
+	s.Lock()
+	defer s.Unlock()
+	s.backend = b
+	s.apiURLSet = true
+}
+
+// Backend returns the chat server the session connects to
+func (s *Session) Backend() Backend {
+	s.RLock()
+	defer s.RUnlock()
+	return s.backend
+}
+
+// WithBackend sets the chat server of the session, see *session.SetBackend()
+func WithBackend(b Backend) Option {
+	return func(s *Session) {
+		s.SetBackend(b)
+	}
+}
@@ -0,0 +1,43 @@
+package dggchat
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestBackend(t *testing.T) {
+	if !DestinyGG.Supports("DONATION") || Strims.Supports("DONATION") || !Strims.Supports("msg") {
+		t.Error("unexpected supported events")
+	}
+	if f, ok := DestinyGG.Flair(FeatureTier4); !ok || f.Name != "Subscriber Tier 4" {
+		t.Errorf("unexpected flair %+v", f)
+	}
+
+	b := ChatGo(url.URL{Scheme: "ws", Host: "localhost:8080", Path: "/ws"})
+	if b.APIURL.String() != "http://localhost:8080" || b.CookieName != "authtoken" {
+		t.Errorf("unexpected chat-go backend %+v", b)
+	}
+
+	s, _ := NewWithOptions(WithLoginKey("key"), WithBackend(Strims))
+	if c := s.authCookie(); c != "jwt=key" {
+		t.Errorf("unexpected auth cookie %q", c)
+	}
+	if err := s.send(messageOut{Data: "hi"}, "PIN"); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestSetBackendReplacesOverrides(t *testing.T) {
+	t.Setenv("CUSTOM_WSHOST", "chat.example.com")
+	t.Setenv("CUSTOM_ORIGINHEADER", "https://example.com")
+
+	s, _ := New()
+	if b := s.Backend(); b.URL.Host != "chat.example.com" || b.Origin != "https://example.com" {
+		t.Errorf("expected the environment to override the default backend, got %+v", b)
+	}
+
+	s.SetBackend(Strims)
+	if b := s.Backend(); b.URL != Strims.URL || b.APIURL != Strims.APIURL || b.Origin != Strims.Origin {
+		t.Errorf("expected the backend to be used as is, got %+v", b)
+	}
+}
@@ -0,0 +1,418 @@
+// Package bridge forwards selected chat events, such as broadcasts, subscriptions, donations,
+// bans or messages matching a filter, to generic JSON webhooks like the ones of Discord or Slack.
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/MemeLabs/dggchat/logging"
+)
+
+// Templates for common webhook receivers. They are executed with a Batch.
+const (
+	DiscordTemplate = `{"content":{{json .Text}}}`
+	SlackTemplate   = `{"text":{{json .Text}}}`
+	// DefaultTemplate sends the events as a JSON array
+	DefaultTemplate = `{"events":{{json .Events}}}`
+)
+
+// Defaults used when a config does not specify them
+const (
+	DefaultRetries       = 3
+	DefaultBackoff       = time.Second
+	DefaultBatchSize     = 10
+	DefaultBatchInterval = 2 * time.Second
+	DefaultQueueSize     = 1000
+)
+
+// ErrQueueFull is reported when events arrive faster than a webhook accepts them
+var ErrQueueFull = errors.New("webhook queue is full, event dropped")
+
+// Webhook is a receiver of chat events
+type Webhook struct {
+	// Name identifies the webhook in errors
+	Name string
+	URL  string
+	// Types lists the event types forwarded, e.g. "BROADCAST", "SUBSCRIPTION", "DONATION", "BAN" or "MSG".
+	// "SUBSCRIPTION" includes gifted subscriptions, which have the types "GIFTSUB" and "MASSGIFT".
+	// If empty, all events that have a text are forwarded.
+	Types []string
+	// Filter additionally decides if an event is forwarded, if set
+	Filter func(dggchat.Event) bool
+	// Template renders the request body of a batch, defaults to DefaultTemplate
+	Template string
+	// Header is added to every request, e.g. for authorization
+	Header http.Header
+}
+
+// Config configures a Bridge
+type Config struct {
+	Webhooks []Webhook
+	// Client sends the requests, defaults to http.DefaultClient
+	Client *http.Client
+	// Retries is the number of times a failed request is retried, a negative value disables retries
+	Retries int
+	// Backoff is the wait before the first retry, it doubles for every further retry
+	Backoff time.Duration
+	// BatchSize is the maximum number of events sent in one request
+	BatchSize int
+	// BatchInterval is the longest time an event waits for more events to be batched with
+	BatchInterval time.Duration
+	// QueueSize is the number of events buffered per webhook
+	QueueSize int
+	// OnError is called when a batch could not be delivered or an event was dropped
+	OnError func(error)
+}
+
+// Item is a single event in a Batch, flattened for use in templates
+type Item struct {
+	Type      string    `json:"type"`
+	Nick      string    `json:"nick,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Amount    int64     `json:"amount,omitempty"`
+	Tier      string    `json:"tier,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// Text is a human readable description of the event
+	Text string `json:"text"`
+}
+
+// Batch is the data templates are executed with
+type Batch struct {
+	Events []Item
+	// Text is the text of all events, one per line
+	Text string
+}
+
+// DeliveryError is reported when a batch could not be delivered to a webhook
+type DeliveryError struct {
+	Webhook  string
+	Attempts int
+	Err      error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("webhook %s: delivery failed after %d attempts: %v", e.Webhook, e.Attempts, e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// statusError is returned for unsuccessful responses
+type statusError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.status)
+}
+
+func (e *statusError) temporary() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// Bridge forwards chat events to webhooks. It is safe for concurrent use.
+type Bridge struct {
+	sync.Mutex
+	config Config
+	hooks  []*hook
+	remove []func()
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type hook struct {
+	Webhook
+	template *template.Template
+	types    map[string]bool
+	queue    chan Item
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// New creates a bridge and starts delivering to its webhooks
+func New(c Config) (*Bridge, error) {
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	} else if c.Retries == 0 {
+		c.Retries = DefaultRetries
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultBackoff
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.BatchInterval <= 0 {
+		c.BatchInterval = DefaultBatchInterval
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+
+	b := &Bridge{config: c}
+	for _, w := range c.Webhooks {
+		if w.Name == "" {
+			w.Name = w.URL
+		}
+		if w.Template == "" {
+			w.Template = DefaultTemplate
+		}
+		t, err := template.New(w.Name).Funcs(funcs).Parse(w.Template)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", w.Name, err)
+		}
+
+		h := &hook{
+			Webhook:  w,
+			template: t,
+			types:    make(map[string]bool, len(w.Types)),
+			queue:    make(chan Item, c.QueueSize),
+		}
+		for _, t := range w.Types {
+			t = strings.ToUpper(t)
+			h.types[t] = true
+			if t == "SUBSCRIPTION" {
+				h.types["GIFTSUB"], h.types["MASSGIFT"] = true, true
+			}
+		}
+		b.hooks = append(b.hooks, h)
+	}
+
+	for _, h := range b.hooks {
+		b.wg.Add(1)
+		go b.run(h)
+	}
+	return b, nil
+}
+
+// MessageMatching returns a webhook filter that passes chat messages matching the expression.
+// Other events are passed unchanged.
+func MessageMatching(re *regexp.Regexp) func(dggchat.Event) bool {
+	return func(e dggchat.Event) bool {
+		m, ok := e.Data.(dggchat.Message)
+		return !ok || re.MatchString(m.Message)
+	}
+}
+
+// Attach starts forwarding all events received by the session.
+// Events replayed from the chat history are not forwarded.
+func (b *Bridge) Attach(s *dggchat.Session) {
+	remove := s.AddEventListener(func(e dggchat.Event, _ *dggchat.Session) {
+		if e.Historical {
+			return
+		}
+		b.HandleEvent(e)
+	})
+
+	b.Lock()
+	defer b.Unlock()
+	b.remove = append(b.remove, remove)
+}
+
+// HandleEvent queues the event for every webhook it is selected by
+func (b *Bridge) HandleEvent(e dggchat.Event) {
+	item, ok := newItem(e)
+	if !ok {
+		return
+	}
+
+	// errors are reported after unlocking, so OnError may use the bridge
+	var errs []error
+	b.Lock()
+	if !b.closed {
+		for _, h := range b.hooks {
+			if !h.selects(e) {
+				continue
+			}
+			select {
+			case h.queue <- item:
+			default:
+				errs = append(errs, fmt.Errorf("webhook %s: %w", h.Name, ErrQueueFull))
+			}
+		}
+	}
+	b.Unlock()
+
+	for _, err := range errs {
+		b.report(err)
+	}
+}
+
+// Close stops forwarding and waits until queued events are delivered
+func (b *Bridge) Close() {
+	b.Lock()
+	for _, remove := range b.remove {
+		remove()
+	}
+	b.remove = nil
+	if !b.closed {
+		b.closed = true
+		for _, h := range b.hooks {
+			close(h.queue)
+		}
+	}
+	b.Unlock()
+
+	b.wg.Wait()
+}
+
+func (h *hook) selects(e dggchat.Event) bool {
+	if len(h.types) > 0 && !h.types[e.Type] {
+		return false
+	}
+	return h.Filter == nil || h.Filter(e)
+}
+
+// run batches the events of a webhook and delivers them
+func (b *Bridge) run(h *hook) {
+	defer b.wg.Done()
+
+	var batch []Item
+	timer := time.NewTimer(b.config.BatchInterval)
+	timer.Stop()
+
+	flush := func() {
+		if len(batch) > 0 {
+			b.deliver(h, batch)
+			batch = nil
+		}
+	}
+
+	for {
+		select {
+		case item, ok := <-h.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(b.config.BatchInterval)
+			}
+			batch = append(batch, item)
+			if len(batch) >= b.config.BatchSize {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// deliver sends a batch, retrying temporary failures with exponential backoff
+func (b *Bridge) deliver(h *hook, items []Item) {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = item.Text
+	}
+
+	var body bytes.Buffer
+	err := h.template.Execute(&body, Batch{Events: items, Text: strings.Join(lines, "\n")})
+	if err != nil {
+		b.report(&DeliveryError{Webhook: h.Name, Err: err})
+		return
+	}
+
+	backoff := b.config.Backoff
+	for attempt := 1; ; attempt++ {
+		err = b.post(h, body.Bytes())
+		if err == nil {
+			return
+		}
+
+		var se *statusError
+		temporary := !errors.As(err, &se) || se.temporary()
+		if !temporary || attempt > b.config.Retries {
+			b.report(&DeliveryError{Webhook: h.Name, Attempts: attempt, Err: err})
+			return
+		}
+
+		wait := backoff
+		if se != nil && se.retryAfter > wait {
+			wait = se.retryAfter
+		}
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+func (b *Bridge) post(h *hook, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		se := &statusError{status: resp.StatusCode}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			se.retryAfter = time.Duration(seconds) * time.Second
+		}
+		return se
+	}
+	return nil
+}
+
+func (b *Bridge) report(err error) {
+	if b.config.OnError != nil {
+		b.config.OnError(err)
+	}
+}
+
+// newItem flattens an event, events without a text like joins are not forwarded
+func newItem(e dggchat.Event) (Item, bool) {
+	t, text, ok := logging.Format(e)
+	if !ok {
+		return Item{}, false
+	}
+	item := Item{Type: e.Type, Timestamp: t, Text: text}
+
+	switch d := e.Data.(type) {
+	case dggchat.Message:
+		item.Nick, item.Message = d.Sender.Nick, d.Message
+	case dggchat.Broadcast:
+		item.Message = d.Message
+	case dggchat.Mute:
+		item.Nick, item.Target = d.Sender.Nick, d.Target.Nick
+	case dggchat.Ban:
+		item.Nick, item.Target = d.Sender.Nick, d.Target.Nick
+	case dggchat.Subscription:
+		item.Nick, item.Target, item.Message, item.Tier = d.Sender.Nick, d.Recipient.Nick, d.Message, d.Tier.Label
+	case dggchat.Donation:
+		item.Nick, item.Message, item.Amount = d.Sender.Nick, d.Message, d.Amount
+	case dggchat.SubOnly:
+		item.Nick = d.Sender.Nick
+	}
+	return item, true
+}
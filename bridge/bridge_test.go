@@ -0,0 +1,265 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+type receiver struct {
+	sync.Mutex
+	*httptest.Server
+	bodies   []string
+	failures int
+}
+
+func newReceiver(failures int, status int) *receiver {
+	r := &receiver{failures: failures}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.Lock()
+		defer r.Unlock()
+		if r.failures > 0 {
+			r.failures--
+			w.WriteHeader(status)
+			return
+		}
+		r.bodies = append(r.bodies, string(body))
+	}))
+	return r
+}
+
+func (r *receiver) received() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+func message(nick string, text string) dggchat.Event {
+	return dggchat.Event{
+		Type: "MSG",
+		Data: dggchat.Message{
+			Sender:    dggchat.User{Nick: nick},
+			Message:   text,
+			Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestBridgeTemplateAndFilter(t *testing.T) {
+	r := newReceiver(0, 0)
+	defer r.Close()
+
+	b, err := New(Config{
+		Webhooks: []Webhook{{
+			URL:      r.URL,
+			Types:    []string{"MSG", "DONATION"},
+			Filter:   MessageMatching(regexp.MustCompile(`(?i)\bbridge\b`)),
+			Template: DiscordTemplate,
+		}},
+		BatchSize:     10,
+		BatchInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.HandleEvent(message("alice", "hello bridge"))
+	b.HandleEvent(message("bob", "not forwarded"))
+	b.HandleEvent(dggchat.Event{Type: "JOIN", Data: dggchat.RoomAction{User: dggchat.User{Nick: "carol"}}})
+	b.HandleEvent(dggchat.Event{Type: "DONATION", Data: dggchat.Donation{Sender: dggchat.User{Nick: "dan"}, Amount: 500}})
+	b.Close()
+
+	bodies := r.received()
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(bodies))
+	}
+	var payload struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := "alice: hello bridge\nDonation: dan donated $5.00"
+	if payload.Content != want {
+		t.Errorf("expected content %q, got %q", want, payload.Content)
+	}
+}
+
+func TestBridgeBatchSize(t *testing.T) {
+	r := newReceiver(0, 0)
+	defer r.Close()
+
+	b, err := New(Config{
+		Webhooks:      []Webhook{{URL: r.URL}},
+		BatchSize:     2,
+		BatchInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		b.HandleEvent(message("alice", "hi"))
+	}
+	b.Close()
+
+	bodies := r.received()
+	if len(bodies) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(bodies))
+	}
+	var batch struct {
+		Events []Item `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Events) != 2 || batch.Events[0].Nick != "alice" || batch.Events[0].Type != "MSG" {
+		t.Errorf("unexpected batch %+v", batch.Events)
+	}
+}
+
+func TestBridgeRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		status    int
+		delivered int
+		attempts  int
+	}{
+		{"recovers", 2, http.StatusInternalServerError, 1, 0},
+		{"gives up", 10, http.StatusBadGateway, 0, 4},
+		{"client error", 1, http.StatusBadRequest, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReceiver(tt.failures, tt.status)
+			defer r.Close()
+
+			var errs []error
+			b, err := New(Config{
+				Webhooks:      []Webhook{{URL: r.URL}},
+				Retries:       3,
+				Backoff:       time.Millisecond,
+				BatchInterval: time.Millisecond,
+				OnError:       func(err error) { errs = append(errs, err) },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.HandleEvent(message("alice", "hi"))
+			b.Close()
+
+			if got := len(r.received()); got != tt.delivered {
+				t.Errorf("expected %d deliveries, got %d", tt.delivered, got)
+			}
+			if tt.attempts == 0 {
+				if len(errs) != 0 {
+					t.Errorf("unexpected errors %v", errs)
+				}
+				return
+			}
+			var de *DeliveryError
+			if len(errs) != 1 || !errors.As(errs[0], &de) {
+				t.Fatalf("expected a delivery error, got %v", errs)
+			}
+			if de.Attempts != tt.attempts {
+				t.Errorf("expected %d attempts, got %d", tt.attempts, de.Attempts)
+			}
+		})
+	}
+}
+
+func TestNewInvalidTemplate(t *testing.T) {
+	_, err := New(Config{Webhooks: []Webhook{{URL: "http://localhost", Template: "{{"}}})
+	if err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
+
+func TestBridgeGiftedSubscriptions(t *testing.T) {
+	r := newReceiver(0, 0)
+	defer r.Close()
+
+	b, err := New(Config{
+		Webhooks:      []Webhook{{URL: r.URL, Types: []string{"subscription"}}},
+		BatchSize:     10,
+		BatchInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := dggchat.Subscription{Sender: dggchat.User{Nick: "alice"}, Recipient: dggchat.User{Nick: "bob"}, Quantity: 5}
+	for _, typ := range []string{"SUBSCRIPTION", "GIFTSUB", "MASSGIFT", "DONATION"} {
+		b.HandleEvent(dggchat.Event{Type: typ, Data: sub})
+	}
+	b.Close()
+
+	bodies := r.received()
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(bodies))
+	}
+	var batch struct {
+		Events []Item `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Events) != 3 || batch.Events[1].Type != "GIFTSUB" || batch.Events[2].Type != "MASSGIFT" {
+		t.Errorf("unexpected batch %+v", batch.Events)
+	}
+}
+
+func TestBridgeReportsWithoutLock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	reported := make(chan error, 10)
+	var b *Bridge
+	b, err := New(Config{
+		Webhooks:      []Webhook{{URL: srv.URL}},
+		BatchSize:     1,
+		BatchInterval: time.Hour,
+		QueueSize:     1,
+		// the error callback may use the bridge
+		OnError: func(err error) {
+			b.Lock()
+			b.Unlock()
+			reported <- err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	defer close(release)
+
+	done := make(chan struct{})
+	go func() {
+		// the first event is being delivered and the second one queued, so the rest are dropped
+		for i := 0; i < 5; i++ {
+			b.HandleEvent(message("alice", "hi"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected errors to be reported without holding the lock")
+	}
+	if err := <-reported; !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Command dggchat is an interactive terminal client for destinygg chat.
+//
+// Usage:
+//
+//	dggchat [-key loginkey] [-url wss://host/ws] [-api https://host] [-demo]
+//
+// The login key can also be given in the DGG_KEY environment variable, without
+// one the client connects read-only. With -demo, the client connects to an
+// in-process fake server with a few simulated users instead.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/MemeLabs/dggchat/dggchattest"
+)
+
+func main() {
+	key := flag.String("key", os.Getenv("DGG_KEY"), "login key, defaults to $DGG_KEY")
+	wsURL := flag.String("url", "", "websocket url of the chat server")
+	apiURL := flag.String("api", "", "base url of the http api")
+	demo := flag.Bool("demo", false, "connect to an in-process fake server")
+	flag.Parse()
+
+	if *demo {
+		srv := startDemo()
+		defer srv.Close()
+		u, a := srv.URL(), srv.APIURL()
+		*wsURL, *apiURL, *key = u.String(), a.String(), "demo"
+	}
+
+	var args []string
+	if *key != "" {
+		args = append(args, *key)
+	}
+	s, err := dggchat.New(args...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *wsURL != "" {
+		u, err := url.Parse(*wsURL)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		s.SetURL(*u)
+	}
+	if *apiURL != "" {
+		u, err := url.Parse(*apiURL)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		s.SetAPIURL(*u)
+	}
+
+	restore, err := makeRaw()
+	if err != nil {
+		log.Fatalf("dggchat needs an interactive terminal: %v", err)
+	}
+	fmt.Print(altScreenOn + clearScreen)
+	defer func() {
+		fmt.Print(reset + clearScreen + altScreenOff + showCursor)
+		restore()
+	}()
+
+	u := newUI(s, os.Stdout)
+	u.resize(termSize())
+	addHandlers(s, u)
+
+	u.chatInfo("connecting to %s", describeURL(*wsURL))
+	if err := s.Open(); err != nil {
+		u.chatInfo("error connecting: %v", err)
+	}
+	defer s.Close()
+
+	go func() {
+		for range u.dirty {
+			u.render()
+		}
+	}()
+	go func() {
+		for range time.Tick(time.Second) {
+			if u.resize(termSize()) {
+				fmt.Print(clearScreen)
+				u.redraw()
+			}
+		}
+	}()
+	u.redraw()
+
+	buf := make([]byte, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			if !u.handleKey(k) {
+				return
+			}
+		}
+	}
+}
+
+func describeURL(u string) string {
+	if u == "" {
+		return "destiny.gg"
+	}
+	return u
+}
+
+func addHandlers(s *dggchat.Session, u *ui) {
+	s.AddMessageHandler(func(m dggchat.Message, _ *dggchat.Session) {
+		text := m.Message
+		if m.IsAction() {
+			text = "*" + strings.TrimPrefix(text, "/me ") + "*"
+		}
+		u.add(chatTab, line{time: m.Timestamp, nick: m.Sender.Nick, user: m.Sender, text: text})
+	})
+	s.AddPMHandler(func(pm dggchat.PrivateMessage, _ *dggchat.Session) {
+		u.add(pm.User.Nick, line{time: pm.Timestamp, nick: pm.User.Nick, user: pm.User, text: pm.Message})
+	})
+	s.AddNamesHandler(func(n dggchat.Names, _ *dggchat.Session) {
+		u.chatInfo("connected, %d users and %d connections", len(n.Users), n.Connections)
+	})
+	s.AddJoinHandler(func(dggchat.RoomAction, *dggchat.Session) { u.redraw() })
+	s.AddQuitHandler(func(dggchat.RoomAction, *dggchat.Session) { u.redraw() })
+	s.AddMuteHandler(func(m dggchat.Mute, _ *dggchat.Session) {
+		u.chatInfo("%s muted by %s", m.Target.Nick, m.Sender.Nick)
+	})
+	s.AddUnmuteHandler(func(m dggchat.Mute, _ *dggchat.Session) {
+		u.chatInfo("%s unmuted by %s", m.Target.Nick, m.Sender.Nick)
+	})
+	s.AddBanHandler(func(b dggchat.Ban, _ *dggchat.Session) {
+		u.chatInfo("%s banned by %s", b.Target.Nick, b.Sender.Nick)
+	})
+	s.AddUnbanHandler(func(b dggchat.Ban, _ *dggchat.Session) {
+		u.chatInfo("%s unbanned by %s", b.Target.Nick, b.Sender.Nick)
+	})
+	s.AddSubOnlyHandler(func(so dggchat.SubOnly, _ *dggchat.Session) {
+		mode := "disabled"
+		if so.Active {
+			mode = "enabled"
+		}
+		u.chatInfo("subscriber only mode %s by %s", mode, so.Sender.Nick)
+	})
+	s.AddBroadcastHandler(func(b dggchat.Broadcast, _ *dggchat.Session) {
+		u.chatInfo("broadcast: %s", b.Message)
+	})
+	s.AddSubscriptionHandler(func(sub dggchat.Subscription, _ *dggchat.Session) {
+		u.chatInfo("%s subscribed (%s) %s", sub.Recipient.Nick, sub.Tier.Label, sub.Message)
+	})
+	s.AddDonationHandler(func(d dggchat.Donation, _ *dggchat.Session) {
+		u.chatInfo("%s donated $%d.%02d %s", d.Sender.Nick, d.Amount/100, d.Amount%100, d.Message)
+	})
+	s.AddErrorHandler(func(e string, _ *dggchat.Session) {
+		u.info("server error: %s", e)
+	})
+	s.AddSocketErrorHandler(func(err error, _ *dggchat.Session) {
+		u.chatInfo("connection lost: %v, reconnecting", err)
+	})
+}
+
+// startDemo starts a fake server with some users chatting
+func startDemo() *dggchattest.Server {
+	users := []dggchat.User{
+		{Nick: "Destiny", Features: []string{dggchat.FeatureAdministrator, dggchat.FeatureBroadcaster}},
+		{Nick: "Bot", Features: []string{dggchat.FeatureBot}},
+		{Nick: "ModUser", Features: []string{dggchat.FeatureModerator}},
+		{Nick: "alice", Features: []string{dggchat.FeatureSubscriber, dggchat.FeatureTier4}},
+		{Nick: "bob", Features: []string{dggchat.FeatureSubscriber, dggchat.FeatureTier2}},
+		{Nick: "carol", Features: []string{dggchat.FeatureVIP}},
+		{Nick: "dave"},
+	}
+	messages := []string{
+		"hello chat",
+		"PepeLaugh",
+		"did anyone see that?",
+		"/me waves",
+		"this is a longer message to show how lines are wrapped when they do not fit into the chat view anymore",
+		"Destiny are you there?",
+	}
+
+	srv := dggchattest.NewServer()
+	srv.SetUsers(users...)
+	srv.SetMe(dggchat.User{Nick: "you", Features: []string{dggchat.FeatureModerator}})
+
+	go func() {
+		for range time.Tick(2 * time.Second) {
+			u := users[rand.Intn(len(users))]
+			if rand.Intn(10) == 0 {
+				_ = srv.SendPrivateMessage(u.Nick, "psst, this is a private message")
+				continue
+			}
+			_ = srv.SendMessage(u, messages[rand.Intn(len(messages))])
+		}
+	}()
+
+	return srv
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences used for drawing
+const (
+	altScreenOn  = "\x1b[?1049h"
+	altScreenOff = "\x1b[?1049l"
+	hideCursor   = "\x1b[?25l"
+	showCursor   = "\x1b[?25h"
+	clearScreen  = "\x1b[2J"
+	clearLine    = "\x1b[2K"
+	reset        = "\x1b[0m"
+	bold         = "\x1b[1m"
+	dim          = "\x1b[2m"
+	inverse      = "\x1b[7m"
+)
+
+func moveTo(row, col int) string {
+	return "\x1b[" + strconv.Itoa(row) + ";" + strconv.Itoa(col) + "H"
+}
+
+func color(c int) string {
+	return "\x1b[38;5;" + strconv.Itoa(c) + "m"
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// makeRaw puts the terminal into raw mode, the returned function restores the previous mode
+func makeRaw() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() {
+		_, _ = stty(state)
+	}, nil
+}
+
+// termSize returns the number of columns and rows of the terminal
+func termSize() (int, int) {
+	out, err := stty("size")
+	if err != nil {
+		return 80, 24
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 80, 24
+	}
+	rows, err1 := strconv.Atoi(fields[0])
+	cols, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil || rows < 5 || cols < 20 {
+		return 80, 24
+	}
+	return cols, rows
+}
+
+// key is a single key press read from the terminal
+type key struct {
+	r    rune
+	name string
+}
+
+// Names of special keys
+const (
+	keyEnter     = "enter"
+	keyBackspace = "backspace"
+	keyTab       = "tab"
+	keyLeft      = "left"
+	keyRight     = "right"
+	keyUp        = "up"
+	keyDown      = "down"
+	keyHome      = "home"
+	keyEnd       = "end"
+	keyPageUp    = "pgup"
+	keyPageDown  = "pgdown"
+	keyCtrlC     = "ctrl-c"
+	keyCtrlN     = "ctrl-n"
+	keyCtrlP     = "ctrl-p"
+	keyCtrlW     = "ctrl-w"
+	keyCtrlU     = "ctrl-u"
+)
+
+var escapeKeys = map[string]string{
+	"[A":  keyUp,
+	"[B":  keyDown,
+	"[C":  keyRight,
+	"[D":  keyLeft,
+	"[H":  keyHome,
+	"[F":  keyEnd,
+	"[1~": keyHome,
+	"[4~": keyEnd,
+	"[5~": keyPageUp,
+	"[6~": keyPageDown,
+}
+
+// parseKeys splits raw terminal input into key presses
+func parseKeys(b []byte) []key {
+	var keys []key
+	s := string(b)
+	for len(s) > 0 {
+		switch c := s[0]; {
+		case c == 0x1b:
+			seq := s[1:]
+			end := strings.IndexAny(seq, "ABCDHF~")
+			if len(seq) > 0 && seq[0] == '[' && end > 0 {
+				if name, ok := escapeKeys[seq[:end+1]]; ok {
+					keys = append(keys, key{name: name})
+				}
+				s = seq[end+1:]
+				continue
+			}
+			s = seq
+		case c == '\r' || c == '\n':
+			keys = append(keys, key{name: keyEnter})
+			s = s[1:]
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, key{name: keyBackspace})
+			s = s[1:]
+		case c == '\t':
+			keys = append(keys, key{name: keyTab})
+			s = s[1:]
+		case c == 0x03:
+			keys = append(keys, key{name: keyCtrlC})
+			s = s[1:]
+		case c == 0x0e:
+			keys = append(keys, key{name: keyCtrlN})
+			s = s[1:]
+		case c == 0x10:
+			keys = append(keys, key{name: keyCtrlP})
+			s = s[1:]
+		case c == 0x17:
+			keys = append(keys, key{name: keyCtrlW})
+			s = s[1:]
+		case c == 0x15:
+			keys = append(keys, key{name: keyCtrlU})
+			s = s[1:]
+		case c < 0x20:
+			s = s[1:]
+		default:
+			r, size := utf8.DecodeRuneInString(s)
+			keys = append(keys, key{r: r})
+			s = s[size:]
+		}
+	}
+	return keys
+}
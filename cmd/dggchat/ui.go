@@ -0,0 +1,557 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+const (
+	sidebarWidth = 22
+	maxLines     = 1000
+	chatTab      = "chat"
+)
+
+// line is a single entry of a tab's history
+type line struct {
+	time time.Time
+	nick string
+	user dggchat.User
+	text string
+	info bool
+}
+
+// tab is either the public chat or a private conversation with a user
+type tab struct {
+	name   string
+	lines  []line
+	unread bool
+}
+
+type ui struct {
+	sync.Mutex
+	session *dggchat.Session
+	out     io.Writer
+	tabs    []*tab
+	active  int
+	input   []rune
+	cursor  int
+	scroll  int
+	width   int
+	height  int
+	dirty   chan struct{}
+
+	// tab completion state
+	completions []string
+	completion  int
+	completeAt  int
+}
+
+func newUI(s *dggchat.Session, out io.Writer) *ui {
+	return &ui{
+		session: s,
+		out:     out,
+		tabs:    []*tab{{name: chatTab}},
+		width:   80,
+		height:  24,
+		dirty:   make(chan struct{}, 1),
+	}
+}
+
+// redraw schedules a redraw of the screen
+func (u *ui) redraw() {
+	select {
+	case u.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// tab returns the tab with the given name, creating it if needed.
+// call with locks held
+func (u *ui) tab(name string) *tab {
+	for _, t := range u.tabs {
+		if strings.EqualFold(t.name, name) {
+			return t
+		}
+	}
+	t := &tab{name: name}
+	u.tabs = append(u.tabs, t)
+	return t
+}
+
+// sanitize replaces control characters sent by the server, so nobody can move the cursor,
+// clear the screen or otherwise control the terminal through chat
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return utf8.RuneError
+		}
+		return r
+	}, s)
+}
+
+func (u *ui) add(tabName string, l line) {
+	tabName, l.nick, l.text = sanitize(tabName), sanitize(l.nick), sanitize(l.text)
+	u.Lock()
+	t := u.tab(tabName)
+	t.lines = append(t.lines, l)
+	if len(t.lines) > maxLines {
+		t.lines = t.lines[len(t.lines)-maxLines:]
+	}
+	if u.tabs[u.active] != t {
+		t.unread = true
+	}
+	u.Unlock()
+	u.redraw()
+}
+
+func (u *ui) info(format string, args ...interface{}) {
+	u.Lock()
+	name := u.tabs[u.active].name
+	u.Unlock()
+	u.add(name, line{time: time.Now(), text: fmt.Sprintf(format, args...), info: true})
+}
+
+func (u *ui) chatInfo(format string, args ...interface{}) {
+	u.add(chatTab, line{time: time.Now(), text: fmt.Sprintf(format, args...), info: true})
+}
+
+// handleKey applies a key press, returns false if the client should quit
+func (u *ui) handleKey(k key) bool {
+	u.Lock()
+	defer u.redraw()
+
+	if k.name != keyTab {
+		u.completions = nil
+	}
+
+	switch k.name {
+	case keyCtrlC:
+		u.Unlock()
+		return false
+	case keyEnter:
+		text := strings.TrimSpace(string(u.input))
+		target := u.tabs[u.active].name
+		u.input = u.input[:0]
+		u.cursor = 0
+		u.scroll = 0
+		u.Unlock()
+		if text != "" {
+			return u.submit(target, text)
+		}
+		return true
+	case keyBackspace:
+		if u.cursor > 0 {
+			u.input = append(u.input[:u.cursor-1], u.input[u.cursor:]...)
+			u.cursor--
+		}
+	case keyLeft:
+		if u.cursor > 0 {
+			u.cursor--
+		}
+	case keyRight:
+		if u.cursor < len(u.input) {
+			u.cursor++
+		}
+	case keyHome:
+		u.cursor = 0
+	case keyEnd:
+		u.cursor = len(u.input)
+	case keyCtrlU:
+		u.input = u.input[:0]
+		u.cursor = 0
+	case keyPageUp, keyUp:
+		u.scroll += u.pageSize(k.name)
+	case keyPageDown, keyDown:
+		u.scroll -= u.pageSize(k.name)
+		if u.scroll < 0 {
+			u.scroll = 0
+		}
+	case keyCtrlN:
+		u.switchTab(1)
+	case keyCtrlP:
+		u.switchTab(-1)
+	case keyCtrlW:
+		if u.active > 0 {
+			u.tabs = append(u.tabs[:u.active], u.tabs[u.active+1:]...)
+			u.switchTab(-1)
+		}
+	case keyTab:
+		u.complete()
+	case "":
+		u.input = append(u.input[:u.cursor], append([]rune{k.r}, u.input[u.cursor:]...)...)
+		u.cursor++
+	}
+
+	u.Unlock()
+	return true
+}
+
+// call with locks held
+func (u *ui) pageSize(name string) int {
+	if name == keyUp || name == keyDown {
+		return 1
+	}
+	return u.height - 3
+}
+
+// call with locks held
+func (u *ui) switchTab(delta int) {
+	u.active = (u.active + delta + len(u.tabs)) % len(u.tabs)
+	u.tabs[u.active].unread = false
+	u.scroll = 0
+}
+
+// complete replaces the word before the cursor with the next matching nick.
+// call with locks held
+func (u *ui) complete() {
+	if u.completions == nil {
+		start := u.cursor
+		for start > 0 && u.input[start-1] != ' ' {
+			start--
+		}
+		prefix := strings.ToLower(strings.TrimPrefix(string(u.input[start:u.cursor]), "@"))
+		if prefix == "" {
+			return
+		}
+		for _, user := range u.session.GetUsers() {
+			if strings.HasPrefix(strings.ToLower(user.Nick), prefix) {
+				u.completions = append(u.completions, user.Nick)
+			}
+		}
+		if len(u.completions) == 0 {
+			return
+		}
+		sort.Strings(u.completions)
+		u.completion = -1
+		u.completeAt = start
+	}
+
+	u.completion = (u.completion + 1) % len(u.completions)
+	nick := []rune(u.completions[u.completion] + " ")
+	rest := u.input[u.cursor:]
+	u.input = append(append(append([]rune{}, u.input[:u.completeAt]...), nick...), rest...)
+	u.cursor = u.completeAt + len(nick)
+}
+
+// submit sends the text typed into the tab with the given name, returns false on /quit
+func (u *ui) submit(target string, text string) bool {
+	if !strings.HasPrefix(text, "/") {
+		if target == chatTab {
+			u.report(u.session.SendMessage(text))
+			return true
+		}
+		u.sendPrivateMessage(target, text)
+		return true
+	}
+
+	fields := strings.Fields(text)
+	command := strings.ToLower(fields[0])
+	args := fields[1:]
+	rest := func(n int) string {
+		if len(args) <= n {
+			return ""
+		}
+		return strings.Join(args[n:], " ")
+	}
+
+	switch command {
+	case "/quit", "/exit":
+		return false
+	case "/me":
+		u.report(u.session.SendAction(rest(0)))
+	case "/w", "/whisper", "/msg", "/tell":
+		if len(args) < 2 {
+			u.info("usage: /w <nick> <message>")
+			return true
+		}
+		u.sendPrivateMessage(args[0], rest(1))
+	case "/mute":
+		if len(args) < 1 {
+			u.info("usage: /mute <nick> [duration]")
+			return true
+		}
+		var d time.Duration
+		if len(args) > 1 {
+			var err error
+			if d, err = time.ParseDuration(args[1]); err != nil {
+				u.info("invalid duration %q", args[1])
+				return true
+			}
+		}
+		u.report(u.session.SendMute(args[0], d))
+	case "/unmute":
+		if len(args) < 1 {
+			u.info("usage: /unmute <nick>")
+			return true
+		}
+		u.report(u.session.SendUnmute(args[0]))
+	case "/ban", "/ipban":
+		if len(args) < 3 {
+			u.info("usage: %s <nick> <duration|perm> <reason>", command)
+			return true
+		}
+		banip := command == "/ipban"
+		if args[1] == "perm" {
+			u.report(u.session.SendPermanentBan(args[0], rest(2), banip))
+			return true
+		}
+		d, err := time.ParseDuration(args[1])
+		if err != nil {
+			u.info("invalid duration %q", args[1])
+			return true
+		}
+		u.report(u.session.SendBan(args[0], rest(2), d, banip))
+	case "/unban":
+		if len(args) < 1 {
+			u.info("usage: /unban <nick>")
+			return true
+		}
+		u.report(u.session.SendUnban(args[0]))
+	case "/subonly":
+		if len(args) < 1 || (args[0] != "on" && args[0] != "off") {
+			u.info("usage: /subonly on|off")
+			return true
+		}
+		u.report(u.session.SendSubOnly(args[0] == "on"))
+	case "/broadcast":
+		u.report(u.session.SendBroadcast(rest(0)))
+	case "/close":
+		u.Lock()
+		if u.active > 0 {
+			u.tabs = append(u.tabs[:u.active], u.tabs[u.active+1:]...)
+			u.switchTab(-1)
+		}
+		u.Unlock()
+	case "/help":
+		u.info("commands: /me, /w <nick> <msg>, /mute <nick> [duration], /unmute <nick>, " +
+			"/ban <nick> <duration|perm> <reason>, /ipban, /unban <nick>, /subonly on|off, /broadcast <msg>, /close, /quit")
+		u.info("keys: tab completes nicks, ctrl-n/ctrl-p switch tabs, ctrl-w closes a tab, pgup/pgdown scroll")
+	default:
+		u.info("unknown command %s, see /help", command)
+	}
+	return true
+}
+
+func (u *ui) sendPrivateMessage(nick string, text string) {
+	if err := u.session.SendPrivateMessage(nick, text); err != nil {
+		u.report(err)
+		return
+	}
+
+	me, _ := u.session.Me()
+	u.Lock()
+	t := u.tab(nick)
+	for i, other := range u.tabs {
+		if other == t {
+			u.active = i
+		}
+	}
+	u.Unlock()
+	u.add(nick, line{time: time.Now(), nick: me.Nick, user: me, text: text})
+}
+
+func (u *ui) report(err error) {
+	if err != nil {
+		u.info("error: %v", err)
+	}
+}
+
+// nickColor returns the terminal color for a user, based on their flair
+func nickColor(user dggchat.User) int {
+	switch {
+	case user.IsAdmin():
+		return 196
+	case user.IsMod():
+		return 214
+	case user.IsBot():
+		return 208
+	case user.IsVIP():
+		return 40
+	}
+	switch user.SubTier() {
+	case 4:
+		return 171
+	case 3:
+		return 135
+	case 2:
+		return 75
+	case 1:
+		return 117
+	}
+	return 252
+}
+
+// wrap splits text into lines of at most width runes, breaking on spaces where possible
+func wrap(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var lines []string
+	for utf8.RuneCountInString(text) > width {
+		runes := []rune(text)
+		cut := width
+		for i := width; i > width/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, string(runes[:cut]))
+		text = strings.TrimLeft(string(runes[cut:]), " ")
+	}
+	return append(lines, text)
+}
+
+// pad cuts or pads s with spaces to exactly width runes
+func pad(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
+
+// render draws the whole screen
+func (u *ui) render() {
+	u.Lock()
+	defer u.Unlock()
+
+	var b strings.Builder
+	b.WriteString(hideCursor)
+	chatWidth := u.width - sidebarWidth - 1
+	chatHeight := u.height - 3
+
+	// tab bar
+	b.WriteString(moveTo(1, 1) + clearLine)
+	for i, t := range u.tabs {
+		label := " " + t.name + " "
+		switch {
+		case i == u.active:
+			b.WriteString(inverse + label + reset)
+		case t.unread:
+			b.WriteString(bold + label + "*" + reset)
+		default:
+			b.WriteString(dim + label + reset)
+		}
+	}
+
+	// chat view, wrapped and scrolled from the bottom
+	type row struct {
+		prefix string
+		user   *dggchat.User
+		nick   string
+		text   string
+		info   bool
+	}
+	var rows []row
+	for _, l := range u.tabs[u.active].lines {
+		l := l
+		prefix := l.time.Format("15:04") + " "
+		full := prefix + l.text
+		if !l.info {
+			full = prefix + l.nick + ": " + l.text
+		}
+		for i, part := range wrap(full, chatWidth) {
+			r := row{text: part, info: l.info}
+			if i == 0 && !l.info {
+				r.prefix = prefix
+				r.user = &l.user
+				r.nick = l.nick
+				r.text = strings.TrimPrefix(part, prefix+l.nick)
+			}
+			rows = append(rows, r)
+		}
+	}
+	maxScroll := len(rows) - chatHeight
+	if maxScroll < 0 {
+		maxScroll = 0
+	}
+	if u.scroll > maxScroll {
+		u.scroll = maxScroll
+	}
+	end := len(rows) - u.scroll
+	start := end - chatHeight
+	if start < 0 {
+		start = 0
+	}
+	visible := rows[start:end]
+
+	for i := 0; i < chatHeight; i++ {
+		b.WriteString(moveTo(i+2, 1) + clearLine)
+		if i >= len(visible) {
+			continue
+		}
+		r := visible[i]
+		switch {
+		case r.info:
+			b.WriteString(dim + r.text + reset)
+		case r.user != nil:
+			b.WriteString(dim + r.prefix + reset + color(nickColor(*r.user)) + r.nick + reset + r.text)
+		default:
+			b.WriteString(r.text)
+		}
+	}
+
+	// user list sidebar
+	users := u.session.GetUsers()
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Role() != users[j].Role() {
+			return users[i].Role() > users[j].Role()
+		}
+		return strings.ToLower(users[i].Nick) < strings.ToLower(users[j].Nick)
+	})
+	b.WriteString(moveTo(2, chatWidth+1) + "│" + bold + pad(fmt.Sprintf(" %d users", len(users)), sidebarWidth) + reset)
+	for i := 1; i < chatHeight; i++ {
+		b.WriteString(moveTo(i+2, chatWidth+1) + "│")
+		if i-1 < len(users) {
+			user := users[i-1]
+			b.WriteString(color(nickColor(user)) + pad(" "+sanitize(user.Nick), sidebarWidth) + reset)
+		} else {
+			b.WriteString(strings.Repeat(" ", sidebarWidth))
+		}
+	}
+
+	// status and input line
+	status := " " + u.tabs[u.active].name
+	if u.scroll > 0 {
+		status += fmt.Sprintf(" (scrolled up %d lines)", u.scroll)
+	}
+	if me, ok := u.session.Me(); ok {
+		status += " | " + sanitize(me.Nick)
+	}
+	b.WriteString(moveTo(u.height-1, 1) + clearLine + inverse + pad(status, u.width) + reset)
+
+	prompt := "> "
+	inputWidth := u.width - len(prompt) - 1
+	offset := 0
+	if u.cursor > inputWidth {
+		offset = u.cursor - inputWidth
+	}
+	visibleInput := u.input[offset:]
+	if len(visibleInput) > inputWidth {
+		visibleInput = visibleInput[:inputWidth]
+	}
+	b.WriteString(moveTo(u.height, 1) + clearLine + prompt + string(visibleInput))
+	b.WriteString(moveTo(u.height, len(prompt)+u.cursor-offset+1) + showCursor)
+
+	_, _ = io.WriteString(u.out, b.String())
+}
+
+// resize updates the terminal size and reports whether it changed
+func (u *ui) resize(width, height int) bool {
+	u.Lock()
+	defer u.Unlock()
+	if u.width == width && u.height == height {
+		return false
+	}
+	u.width, u.height = width, height
+	return true
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestControlCharacters(t *testing.T) {
+	s, _ := dggchat.New()
+	var out strings.Builder
+	u := newUI(s, &out)
+
+	u.add(chatTab, line{time: time.Now(), nick: "evil\x1b[2J", text: "hi\x1b[2J\x07"})
+	u.add("evil\x1b[2J", line{time: time.Now(), nick: "evil\x1b[2J", text: "\x1b]0;title\x07"})
+	for _, tab := range u.tabs {
+		if strings.ContainsRune(tab.name, '\x1b') {
+			t.Errorf("unexpected control character in tab name %q", tab.name)
+		}
+		for _, l := range tab.lines {
+			if strings.IndexFunc(l.nick+l.text, func(r rune) bool { return r < ' ' }) >= 0 {
+				t.Errorf("unexpected control character in line %q: %q", l.nick, l.text)
+			}
+		}
+	}
+
+	u.render()
+	if strings.Contains(out.String(), clearScreen) {
+		t.Error("expected the screen not to be cleared by chat messages")
+	}
+}
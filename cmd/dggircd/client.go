@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+const (
+	serverName = "dggircd"
+	userHost   = "destiny.gg"
+	actionCTCP = "\x01ACTION "
+)
+
+type config struct {
+	channel string
+	key     string
+	wsURL   *url.URL
+	apiURL  *url.URL
+}
+
+// client is a single IRC connection, with its own chat session
+type client struct {
+	sync.Mutex
+	conn    net.Conn
+	config  config
+	nick    string
+	pass    string
+	user    bool
+	session *dggchat.Session
+}
+
+func newClient(conn net.Conn, c config) *client {
+	return &client{conn: conn, config: c}
+}
+
+func (c *client) send(prefix string, command string, params ...string) {
+	c.Lock()
+	defer c.Unlock()
+	_, _ = c.conn.Write([]byte(format(prefix, command, params...)))
+}
+
+func (c *client) reply(numeric string, params ...string) {
+	c.send(serverName, numeric, append([]string{c.currentNick()}, params...)...)
+}
+
+func (c *client) notice(target string, text string) {
+	c.send(serverName, "NOTICE", target, sanitize(text))
+}
+
+func (c *client) currentNick() string {
+	c.Lock()
+	defer c.Unlock()
+	if c.nick == "" {
+		return "*"
+	}
+	return c.nick
+}
+
+func (c *client) serve() {
+	defer c.conn.Close()
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 4096), 64*1024)
+	for scanner.Scan() {
+		m, ok := parseLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if !c.handle(m) {
+			break
+		}
+	}
+
+	if c.session != nil {
+		_ = c.session.Close()
+	}
+}
+
+// handle processes a message of the IRC client, returns false when the connection should be closed
+func (c *client) handle(m message) bool {
+	switch m.command {
+	case "CAP":
+		if m.param(0) == "LS" {
+			c.send(serverName, "CAP", "*", "LS", "")
+		}
+	case "PASS":
+		c.pass = m.param(0)
+	case "NICK":
+		c.Lock()
+		c.nick = m.param(0)
+		c.Unlock()
+		c.register()
+	case "USER":
+		c.user = true
+		c.register()
+	case "PING":
+		c.send(serverName, "PONG", serverName, m.param(0))
+	case "QUIT":
+		return false
+	}
+
+	if c.session == nil {
+		return true
+	}
+
+	switch m.command {
+	case "PRIVMSG":
+		c.privmsg(m.param(0), m.param(1))
+	case "JOIN":
+		if strings.EqualFold(m.param(0), c.config.channel) {
+			c.join()
+			c.names(c.session)
+		}
+	case "NAMES":
+		c.names(c.session)
+	case "MODE":
+		if strings.EqualFold(m.param(0), c.config.channel) && len(m.params) == 1 {
+			c.reply("324", c.config.channel, "+nt")
+		}
+	case "WHO":
+		c.reply("315", m.param(0), "End of /WHO list.")
+	case "PART":
+		c.send(hostmask(c.currentNick()), "PART", c.config.channel, "")
+	}
+	return true
+}
+
+// register opens the chat session once both NICK and USER were received
+func (c *client) register() {
+	if c.session != nil || c.nick == "" || !c.user {
+		return
+	}
+
+	key := c.config.key
+	if c.pass != "" {
+		key = c.pass
+	}
+	var args []string
+	if key != "" {
+		args = append(args, key)
+	}
+	s, err := dggchat.New(args...)
+	if err != nil {
+		c.notice(c.currentNick(), err.Error())
+		return
+	}
+	if c.config.wsURL != nil {
+		s.SetURL(*c.config.wsURL)
+	}
+	if c.config.apiURL != nil {
+		s.SetAPIURL(*c.config.apiURL)
+	}
+	c.addHandlers(s)
+
+	c.reply("001", "Welcome to destiny.gg chat")
+	c.reply("002", "Your host is "+serverName)
+	c.reply("003", "This server relays destiny.gg chat")
+	c.reply("004", serverName, "dggircd", "o", "bnoqtv")
+	c.reply("422", "MOTD File is missing")
+
+	// use the nick of the dgg account, if it differs from the one chosen in the IRC client
+	if key != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		me, err := s.Validate(ctx)
+		cancel()
+		if errors.Is(err, dggchat.ErrAuthFailed) {
+			c.notice(c.currentNick(), "could not log in to chat: invalid login key")
+			return
+		}
+		if err == nil && me.Nick != c.currentNick() {
+			c.send(hostmask(c.currentNick()), "NICK", me.Nick)
+			c.Lock()
+			c.nick = me.Nick
+			c.Unlock()
+		}
+	}
+
+	// the names list is sent by the names handler, once the server sent it
+	c.join()
+	c.session = s
+	if err := s.Open(); err != nil {
+		c.session = nil
+		c.notice(c.currentNick(), fmt.Sprintf("could not connect to chat: %v", err))
+		return
+	}
+}
+
+func (c *client) join() {
+	c.send(hostmask(c.currentNick()), "JOIN", c.config.channel)
+	c.reply("332", c.config.channel, "destiny.gg chat")
+}
+
+// names sends the IRC names list, moderators are shown as operators and subscribers as voiced
+func (c *client) names(s *dggchat.Session) {
+	users := s.GetUsers()
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, namePrefix(u)+u.Nick)
+	}
+	sort.Strings(names)
+
+	const perLine = 50
+	for i := 0; i < len(names); i += perLine {
+		end := i + perLine
+		if end > len(names) {
+			end = len(names)
+		}
+		c.reply("353", "=", c.config.channel, strings.Join(names[i:end], " "))
+	}
+	c.reply("366", c.config.channel, "End of /NAMES list.")
+}
+
+func namePrefix(u dggchat.User) string {
+	switch {
+	case u.IsMod():
+		return "@"
+	case u.IsSubscriber() || u.IsVIP():
+		return "+"
+	}
+	return ""
+}
+
+// privmsg forwards a message of the IRC client to chat
+func (c *client) privmsg(target string, text string) {
+	var err error
+	action := strings.HasPrefix(text, actionCTCP)
+	if action {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, actionCTCP), "\x01")
+	}
+
+	switch {
+	case strings.EqualFold(target, c.config.channel) && action:
+		err = c.session.SendAction(text)
+	case strings.EqualFold(target, c.config.channel):
+		err = c.session.SendMessage(text)
+	case strings.HasPrefix(target, "#"):
+		c.reply("403", target, "No such channel")
+		return
+	default:
+		err = c.session.SendPrivateMessage(target, text)
+	}
+
+	if err != nil {
+		c.notice(c.currentNick(), fmt.Sprintf("could not send message: %v", err))
+	}
+}
+
+func (c *client) addHandlers(s *dggchat.Session) {
+	channel := c.config.channel
+
+	s.AddMessageHandler(func(m dggchat.Message, _ *dggchat.Session) {
+		// IRC clients show their own messages already
+		if strings.EqualFold(m.Sender.Nick, c.currentNick()) {
+			return
+		}
+		text := sanitize(m.Message)
+		if m.IsAction() {
+			text = actionCTCP + strings.TrimPrefix(text, "/me ") + "\x01"
+		}
+		c.send(hostmask(m.Sender.Nick), "PRIVMSG", channel, text)
+	})
+	s.AddPMHandler(func(pm dggchat.PrivateMessage, _ *dggchat.Session) {
+		c.send(hostmask(pm.User.Nick), "PRIVMSG", c.currentNick(), sanitize(pm.Message))
+	})
+	s.AddNamesHandler(func(_ dggchat.Names, s *dggchat.Session) {
+		c.names(s)
+	})
+	s.AddJoinHandler(func(ra dggchat.RoomAction, _ *dggchat.Session) {
+		if strings.EqualFold(ra.User.Nick, c.currentNick()) {
+			return
+		}
+		c.send(hostmask(ra.User.Nick), "JOIN", channel)
+		if prefix := namePrefix(ra.User); prefix != "" {
+			mode := "+o"
+			if prefix == "+" {
+				mode = "+v"
+			}
+			c.send(serverName, "MODE", channel, mode, ra.User.Nick)
+		}
+	})
+	s.AddQuitHandler(func(ra dggchat.RoomAction, _ *dggchat.Session) {
+		if strings.EqualFold(ra.User.Nick, c.currentNick()) {
+			return
+		}
+		c.send(hostmask(ra.User.Nick), "PART", channel, "")
+	})
+	s.AddMuteHandler(func(m dggchat.Mute, _ *dggchat.Session) {
+		c.notice(channel, fmt.Sprintf("%s muted by %s", m.Target.Nick, m.Sender.Nick))
+	})
+	s.AddUnmuteHandler(func(m dggchat.Mute, _ *dggchat.Session) {
+		c.notice(channel, fmt.Sprintf("%s unmuted by %s", m.Target.Nick, m.Sender.Nick))
+	})
+	s.AddBanHandler(func(b dggchat.Ban, _ *dggchat.Session) {
+		c.send(hostmask(b.Sender.Nick), "MODE", channel, "+b", b.Target.Nick+"!*@*")
+		c.notice(channel, fmt.Sprintf("%s banned by %s", b.Target.Nick, b.Sender.Nick))
+	})
+	s.AddUnbanHandler(func(b dggchat.Ban, _ *dggchat.Session) {
+		c.send(hostmask(b.Sender.Nick), "MODE", channel, "-b", b.Target.Nick+"!*@*")
+	})
+	s.AddSubOnlyHandler(func(so dggchat.SubOnly, _ *dggchat.Session) {
+		mode := "-m"
+		if so.Active {
+			mode = "+m"
+		}
+		c.send(hostmask(so.Sender.Nick), "MODE", channel, mode)
+	})
+	s.AddBroadcastHandler(func(b dggchat.Broadcast, _ *dggchat.Session) {
+		c.notice(channel, "Broadcast: "+b.Message)
+	})
+	s.AddSubscriptionHandler(func(sub dggchat.Subscription, _ *dggchat.Session) {
+		c.notice(channel, fmt.Sprintf("%s subscribed (%s) %s", sub.Recipient.Nick, sub.Tier.Label, sub.Message))
+	})
+	s.AddDonationHandler(func(d dggchat.Donation, _ *dggchat.Session) {
+		c.notice(channel, fmt.Sprintf("%s donated $%d.%02d %s", d.Sender.Nick, d.Amount/100, d.Amount%100, d.Message))
+	})
+	s.AddErrorHandler(func(e string, _ *dggchat.Session) {
+		c.notice(c.currentNick(), "chat error: "+e)
+	})
+	s.AddSocketErrorHandler(func(err error, _ *dggchat.Session) {
+		log.Printf("%s: connection lost: %v", c.currentNick(), err)
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import "strings"
+
+// message is a single line of the IRC protocol
+type message struct {
+	prefix  string
+	command string
+	params  []string
+}
+
+// parseLine parses an IRC line like ":prefix COMMAND param :trailing param"
+func parseLine(line string) (message, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	var m message
+
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return message{}, false
+		}
+		m.prefix, line = line[1:i], line[i+1:]
+	}
+
+	for line != "" {
+		line = strings.TrimLeft(line, " ")
+		if strings.HasPrefix(line, ":") {
+			m.params = append(m.params, line[1:])
+			break
+		}
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			m.params = append(m.params, line)
+			break
+		}
+		m.params = append(m.params, line[:i])
+		line = line[i+1:]
+	}
+
+	if len(m.params) == 0 {
+		return message{}, false
+	}
+	m.command, m.params = strings.ToUpper(m.params[0]), m.params[1:]
+	return m, true
+}
+
+// param returns the i-th parameter, or an empty string
+func (m message) param(i int) string {
+	if i < len(m.params) {
+		return m.params[i]
+	}
+	return ""
+}
+
+// format builds an IRC line, the last parameter is always sent as trailing parameter
+func format(prefix string, command string, params ...string) string {
+	var b strings.Builder
+	if prefix != "" {
+		b.WriteString(":" + prefix + " ")
+	}
+	b.WriteString(command)
+	for i, p := range params {
+		if i == len(params)-1 {
+			b.WriteString(" :" + p)
+		} else {
+			b.WriteString(" " + p)
+		}
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// hostmask returns the IRC prefix used for a dgg user
+func hostmask(nick string) string {
+	return nick + "!" + nick + "@" + userHost
+}
+
+// sanitize removes line breaks, which would end an IRC line early
+func sanitize(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
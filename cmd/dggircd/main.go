@@ -0,0 +1,66 @@
+// Command dggircd exposes destinygg chat as a local IRC server.
+//
+// Usage:
+//
+//	dggircd [-listen 127.0.0.1:6667] [-channel #destinygg] [-key loginkey] [-url wss://host/ws] [-api https://host]
+//
+// Every IRC client gets its own chat connection. The login key is taken from the
+// IRC server password (PASS), -key or $DGG_KEY, without one the connection is read-only.
+// Chat messages appear in the channel, private messages as queries, moderators are
+// channel operators and subscribers are voiced. Mutes, broadcasts, subscriptions and
+// donations are sent as notices, bans as channel bans, and subscriber only mode as +m.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:6667", "address to accept IRC clients on")
+	channel := flag.String("channel", "#destinygg", "IRC channel name for the chat")
+	key := flag.String("key", os.Getenv("DGG_KEY"), "default login key, defaults to $DGG_KEY")
+	wsURL := flag.String("url", "", "websocket url of the chat server")
+	apiURL := flag.String("api", "", "base url of the http api")
+	flag.Parse()
+
+	c := config{
+		channel: *channel,
+		key:     *key,
+	}
+	if !strings.HasPrefix(c.channel, "#") {
+		c.channel = "#" + c.channel
+	}
+	if *wsURL != "" {
+		u, err := url.Parse(*wsURL)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		c.wsURL = u
+	}
+	if *apiURL != "" {
+		u, err := url.Parse(*apiURL)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		c.apiURL = u
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("listening on %s", l.Addr())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		go newClient(conn, c).serve()
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// user is the normalised json form of a dggchat.User
+type user struct {
+	ID          int64      `json:"id,omitempty"`
+	Nick        string     `json:"nick"`
+	Features    []string   `json:"features"`
+	CreatedDate *time.Time `json:"createdDate,omitempty"`
+}
+
+// event is the normalised json form of every dggchat.Event, fields that do not
+// apply to the type of the event are omitted
+type event struct {
+	Type        string     `json:"type"`
+	Received    time.Time  `json:"received"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"`
+	User        *user      `json:"user,omitempty"`
+	Target      *user      `json:"target,omitempty"`
+	Message     string     `json:"message,omitempty"`
+	UUID        string     `json:"uuid,omitempty"`
+	Online      *bool      `json:"online,omitempty"`
+	Active      *bool      `json:"active,omitempty"`
+	Tier        int64      `json:"tier,omitempty"`
+	TierLabel   string     `json:"tierLabel,omitempty"`
+	Quantity    int64      `json:"quantity,omitempty"`
+	Amount      int64      `json:"amount,omitempty"`
+	ID          int        `json:"id,omitempty"`
+	Connections int        `json:"connections,omitempty"`
+	Users       []user     `json:"users,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+func newUser(u dggchat.User) *user {
+	n := &user{ID: u.ID, Nick: u.Nick, Features: u.Features}
+	if n.Features == nil {
+		n.Features = []string{}
+	}
+	if !u.CreatedDate.IsZero() {
+		created := u.CreatedDate.UTC()
+		n.CreatedDate = &created
+	}
+	return n
+}
+
+func timestamp(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// normalize converts an event into its json form.
+// Returns false for events without data, like PRIVMSGSENT.
+func normalize(e dggchat.Event) (event, bool) {
+	n := event{Type: e.Type, Received: e.Received.UTC()}
+
+	switch d := e.Data.(type) {
+	case dggchat.Message:
+		n.Timestamp, n.User, n.Message = timestamp(d.Timestamp), newUser(d.Sender), d.Message
+	case dggchat.Pin:
+		n.Timestamp, n.User, n.Message, n.UUID = timestamp(d.Timestamp), newUser(d.Sender), d.Message, d.UUID
+	case dggchat.Mute:
+		n.Timestamp, n.User, n.Target, n.Online = timestamp(d.Timestamp), newUser(d.Sender), newUser(d.Target), boolPtr(d.Online)
+	case dggchat.Ban:
+		n.Timestamp, n.User, n.Target, n.Online = timestamp(d.Timestamp), newUser(d.Sender), newUser(d.Target), boolPtr(d.Online)
+	case dggchat.Names:
+		n.Connections = d.Connections
+		n.Users = make([]user, 0, len(d.Users))
+		for _, u := range d.Users {
+			n.Users = append(n.Users, *newUser(u))
+		}
+	case dggchat.RoomAction:
+		n.Timestamp, n.User = timestamp(d.Timestamp), newUser(d.User)
+	case dggchat.User:
+		n.User = newUser(d)
+	case dggchat.PrivateMessage:
+		n.Timestamp, n.User, n.Message, n.ID = timestamp(d.Timestamp), newUser(d.User), d.Message, d.ID
+	case dggchat.Broadcast:
+		n.Timestamp, n.Message, n.UUID = timestamp(d.Timestamp), d.Message, d.UUID
+		if d.Sender.Nick != "" {
+			n.User = newUser(d.Sender)
+		}
+	case dggchat.Subscription:
+		n.Timestamp, n.User, n.Target, n.Message = timestamp(d.Timestamp), newUser(d.Sender), newUser(d.Recipient), d.Message
+		n.Tier, n.TierLabel, n.Quantity, n.UUID = d.Tier.Tier, d.Tier.Label, d.Quantity, d.UUID
+	case dggchat.Donation:
+		n.Timestamp, n.User, n.Message, n.Amount, n.UUID = timestamp(d.Timestamp), newUser(d.Sender), d.Message, d.Amount, d.UUID
+	case dggchat.SubOnly:
+		n.Timestamp, n.User, n.Active = timestamp(d.Timestamp), newUser(d.Sender), boolPtr(d.Active)
+	case dggchat.Ping:
+		n.Timestamp = timestamp(time.UnixMilli(d.Timestamp))
+	case string:
+		n.Error = d
+	default:
+		return event{}, false
+	}
+
+	return n, true
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/gorilla/websocket"
+)
+
+type server struct {
+	session  *dggchat.Session
+	hub      *hub
+	token    string
+	upgrader websocket.Upgrader
+}
+
+type sendRequest struct {
+	Nick    string `json:"nick"`
+	Message string `json:"message"`
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.authorizedStream(s.serveEvents))
+	mux.HandleFunc("/ws", s.authorizedStream(s.serveWS))
+	mux.HandleFunc("/send", s.authorized(s.serveSend))
+	mux.HandleFunc("/pm", s.authorized(s.servePM))
+	return mux
+}
+
+// authorized requires the bearer token, if one is configured.
+// Requests from browsers on other sites are always rejected.
+func (s *server) authorized(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !sameOrigin(r) {
+			writeError(w, http.StatusForbidden, "cross origin requests are not allowed")
+			return
+		}
+		if !s.validToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		// a json content type can not be sent by plain html forms
+		if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, "expected content type application/json")
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// authorizedStream requires the bearer token for the event streams, if one is configured,
+// as they include private messages. Browsers can not set headers for EventSource and
+// WebSocket, so the token may also be passed as token query parameter.
+func (s *server) authorizedStream(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if h := r.Header.Get("Authorization"); h != "" {
+			token = strings.TrimPrefix(h, "Bearer ")
+		}
+		if !s.validToken(token) {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// validToken reports whether token matches the configured token, or no token is required
+func (s *server) validToken(token string) bool {
+	return s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// sameOrigin returns false if the request was sent by a browser on another site
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// serveEvents streams events as server-sent events
+func (s *server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	ch := s.hub.subscribe()
+	defer s.hub.unsubscribe(ch)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case b := <-ch:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// serveWS streams events as websocket text messages
+func (s *server) serveWS(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	ch := s.hub.subscribe()
+	defer s.hub.unsubscribe(ch)
+
+	// read and discard client messages, to notice when the client disconnects
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case b := <-ch:
+			if err := ws.WriteMessage(websocket.TextMessage, b); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *server) serveSend(w http.ResponseWriter, r *http.Request) {
+	var req sendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Message == "" {
+		writeError(w, http.StatusBadRequest, "expected json body with a message")
+		return
+	}
+	if err := s.session.SendMessage(req.Message); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) servePM(w http.ResponseWriter, r *http.Request) {
+	var req sendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Message == "" || req.Nick == "" {
+		writeError(w, http.StatusBadRequest, "expected json body with a nick and message")
+		return
+	}
+	if err := s.session.SendPrivateMessage(req.Nick, req.Message); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestStreamsRequireToken(t *testing.T) {
+	s, _ := dggchat.New()
+	srv := httptest.NewServer((&server{session: s, hub: newHub(), token: "secret"}).routes())
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		status int
+	}{
+		{"events without token", "/events", "", http.StatusUnauthorized},
+		{"events with wrong token", "/events?token=guess", "", http.StatusUnauthorized},
+		{"events with wrong header", "/events?token=secret", "Bearer guess", http.StatusUnauthorized},
+		{"events with query token", "/events?token=secret", "", http.StatusOK},
+		{"events with header", "/events", "Bearer secret", http.StatusOK},
+		{"websocket without token", "/ws", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "sync"
+
+// subscriberBuffer is the number of events buffered per subscriber,
+// events are dropped for subscribers that fall further behind
+const subscriberBuffer = 256
+
+// hub fans out encoded events to any number of subscribers
+type hub struct {
+	sync.Mutex
+	subscribers map[chan []byte]struct{}
+}
+
+func newHub() *hub {
+	return &hub{subscribers: make(map[chan []byte]struct{})}
+}
+
+func (h *hub) subscribe() chan []byte {
+	h.Lock()
+	defer h.Unlock()
+	ch := make(chan []byte, subscriberBuffer)
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (h *hub) unsubscribe(ch chan []byte) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.subscribers, ch)
+}
+
+func (h *hub) publish(b []byte) {
+	h.Lock()
+	defer h.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- b:
+		default:
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Command dggrelay holds a single destinygg chat connection and relays every
+// event as a normalised json object, one per line, on stdout.
+//
+// Usage:
+//
+//	dggrelay [-key loginkey] [-url wss://host/ws] [-api https://host] [-http 127.0.0.1:8080] [-token secret] [-quiet]
+//
+// With -http, events are also served to any number of clients:
+//
+//	GET  /events  server-sent events, one json event per message
+//	GET  /ws      websocket, one json event per text message
+//	POST /send    {"message": "..."} sends a chat message
+//	POST /pm      {"nick": "...", "message": "..."} sends a private message
+//
+// If -token is set, every endpoint requires an "Authorization: Bearer <token>" header.
+// /events and /ws also accept the token as ?token= query parameter, for browsers.
+// A token is required to serve http with a login key. The POST endpoints only accept
+// application/json bodies and reject requests from browsers on other sites.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func main() {
+	key := flag.String("key", os.Getenv("DGG_KEY"), "login key, defaults to $DGG_KEY")
+	wsURL := flag.String("url", "", "websocket url of the chat server")
+	apiURL := flag.String("api", "", "base url of the http api")
+	addr := flag.String("http", "", "address to serve events and the send api on, e.g. 127.0.0.1:8080")
+	token := flag.String("token", os.Getenv("DGGRELAY_TOKEN"), "bearer token required by the http endpoints, defaults to $DGGRELAY_TOKEN")
+	quiet := flag.Bool("quiet", false, "do not write events to stdout")
+	flag.Parse()
+
+	if *addr != "" && *key != "" && *token == "" {
+		log.Fatalln("-token is required to serve http with a login key")
+	}
+
+	var args []string
+	if *key != "" {
+		args = append(args, *key)
+	}
+	s, err := dggchat.New(args...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *wsURL != "" {
+		u, err := url.Parse(*wsURL)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		s.SetURL(*u)
+	}
+	if *apiURL != "" {
+		u, err := url.Parse(*apiURL)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		s.SetAPIURL(*u)
+	}
+
+	h := newHub()
+	var stdout sync.Mutex
+	out := bufio.NewWriter(os.Stdout)
+
+	s.AddEventListener(func(e dggchat.Event, _ *dggchat.Session) {
+		n, ok := normalize(e)
+		if !ok {
+			return
+		}
+		b, err := json.Marshal(n)
+		if err != nil {
+			return
+		}
+		h.publish(b)
+
+		if *quiet {
+			return
+		}
+		stdout.Lock()
+		defer stdout.Unlock()
+		_, _ = out.Write(append(b, '\n'))
+		_ = out.Flush()
+	})
+	s.AddSocketErrorHandler(func(err error, _ *dggchat.Session) {
+		log.Printf("connection lost: %v", err)
+	})
+
+	if err := s.Open(); err != nil {
+		log.Fatalln(err)
+	}
+	defer s.Close()
+
+	if *addr != "" {
+		srv := &server{session: s, hub: h, token: *token}
+		go func() {
+			log.Fatalln(http.ListenAndServe(*addr, srv.routes()))
+		}()
+	}
+
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
+	<-sc
+}
@@ -0,0 +1,305 @@
+// Package commands provides a router for "!command" style chat bot commands,
+// to be used with the message handlers of a dggchat session.
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// DefaultPrefix is the prefix used when creating a router with an empty prefix
+const DefaultPrefix = "!"
+
+// ErrDuplicateCommand is thrown when registering a command whose name or alias is already in use
+var ErrDuplicateCommand = errors.New("command name or alias already registered")
+
+// ErrInvalidCommand is thrown when registering a command without name or handler
+var ErrInvalidCommand = errors.New("command requires a name and a handler")
+
+// Command describes a single chat command
+type Command struct {
+	// Name is the name of the command, without prefix
+	Name string
+	// Aliases are alternative names the command can be invoked with
+	Aliases []string
+	// Usage describes the expected arguments, e.g. "<nick> [duration]"
+	Usage string
+	// Description is shown in the help output
+	Description string
+	// MinArgs is the minimum amount of arguments, the usage is sent as reply if less are given
+	MinArgs int
+	// Features restricts the command to users having at least one of the given features.
+	// If empty, everybody may use the command.
+	Features []string
+	// Cooldown is the minimum time between two uses of the command by anyone
+	Cooldown time.Duration
+	// UserCooldown is the minimum time between two uses of the command by the same user
+	UserCooldown time.Duration
+	// Handler is called when the command is invoked
+	Handler func(*Context)
+}
+
+// Context holds information about a single command invocation
+type Context struct {
+	Session *dggchat.Session
+	Sender  dggchat.User
+	// Name is the command name as typed by the user, which may be an alias
+	Name string
+	// Args are the parsed arguments, double quotes group words into a single argument
+	Args []string
+	// Raw is the full message text
+	Raw       string
+	Timestamp time.Time
+	// Private is true if the command was sent in a private message
+	Private bool
+}
+
+// Reply answers the command in the same place it was received,
+// either as chat message or as private message to the sender.
+func (c *Context) Reply(message string) error {
+	if c.Private {
+		return c.Session.SendPrivateMessage(c.Sender.Nick, message)
+	}
+	return c.Session.SendMessage(message)
+}
+
+// Router dispatches chat messages to registered commands
+type Router struct {
+	sync.Mutex
+	prefix   string
+	commands map[string]*Command
+	ordered  []*Command
+	lastUse  map[string]time.Time
+	now      func() time.Time
+}
+
+// NewRouter creates a router for commands starting with the given prefix.
+// A "help" command listing all commands available to the user is registered automatically.
+func NewRouter(prefix string) *Router {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	r := &Router{
+		prefix:   prefix,
+		commands: make(map[string]*Command),
+		lastUse:  make(map[string]time.Time),
+		now:      time.Now,
+	}
+	_ = r.Register(Command{
+		Name:        "help",
+		Usage:       "[command]",
+		Description: "lists available commands",
+		Handler:     r.help,
+	})
+	return r
+}
+
+// Register adds a command to the router
+func (r *Router) Register(c Command) error {
+	if strings.TrimSpace(c.Name) == "" || c.Handler == nil {
+		return ErrInvalidCommand
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	names := append([]string{c.Name}, c.Aliases...)
+	for _, name := range names {
+		if _, ok := r.commands[strings.ToLower(name)]; ok {
+			return ErrDuplicateCommand
+		}
+	}
+
+	cmd := &c
+	for _, name := range names {
+		r.commands[strings.ToLower(name)] = cmd
+	}
+	r.ordered = append(r.ordered, cmd)
+	sort.Slice(r.ordered, func(i, j int) bool { return r.ordered[i].Name < r.ordered[j].Name })
+
+	return nil
+}
+
+// HandleMessage handles a public chat message, it can be passed to *session.AddMessageHandler().
+// Messages replayed from the chat history are ignored.
+func (r *Router) HandleMessage(m dggchat.Message, s *dggchat.Session) {
+	if m.Historical {
+		return
+	}
+	r.handle(&Context{
+		Session:   s,
+		Sender:    m.Sender,
+		Raw:       m.Message,
+		Timestamp: m.Timestamp,
+	})
+}
+
+// HandlePrivateMessage handles a private message, it can be passed to *session.AddPMHandler()
+func (r *Router) HandlePrivateMessage(m dggchat.PrivateMessage, s *dggchat.Session) {
+	r.handle(&Context{
+		Session:   s,
+		Sender:    m.User,
+		Raw:       m.Message,
+		Timestamp: m.Timestamp,
+		Private:   true,
+	})
+}
+
+func (r *Router) handle(ctx *Context) {
+	if !strings.HasPrefix(ctx.Raw, r.prefix) {
+		return
+	}
+	// never respond to ourself
+	if me, ok := ctx.Session.Me(); ok && strings.EqualFold(me.Nick, ctx.Sender.Nick) {
+		return
+	}
+
+	text := strings.TrimPrefix(ctx.Raw, r.prefix)
+	if strings.TrimLeft(text, " \t") != text {
+		return
+	}
+
+	args := parseArgs(text)
+	if len(args) == 0 {
+		return
+	}
+	ctx.Name = args[0]
+	ctx.Args = args[1:]
+
+	cmd, ok := r.lookup(ctx.Name)
+	if !ok || !allowed(cmd, ctx.Sender) {
+		return
+	}
+
+	// invalid invocations do not start the cooldowns
+	if len(ctx.Args) < cmd.MinArgs {
+		_ = ctx.Reply(r.usage(cmd))
+		return
+	}
+	if !r.take(cmd, ctx.Sender) {
+		return
+	}
+
+	cmd.Handler(ctx)
+}
+
+func (r *Router) lookup(name string) (*Command, bool) {
+	r.Lock()
+	defer r.Unlock()
+	cmd, ok := r.commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// take checks the cooldowns of the command and records its use if allowed.
+func (r *Router) take(cmd *Command, user dggchat.User) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	now := r.now()
+	cmdKey := cmd.Name
+	userKey := cmd.Name + " " + strings.ToLower(user.Nick)
+
+	if last, ok := r.lastUse[cmdKey]; ok && now.Sub(last) < cmd.Cooldown {
+		return false
+	}
+	if last, ok := r.lastUse[userKey]; ok && now.Sub(last) < cmd.UserCooldown {
+		return false
+	}
+
+	if cmd.Cooldown > 0 {
+		r.lastUse[cmdKey] = now
+	}
+	if cmd.UserCooldown > 0 {
+		r.lastUse[userKey] = now
+	}
+	return true
+}
+
+func allowed(cmd *Command, user dggchat.User) bool {
+	if len(cmd.Features) == 0 {
+		return true
+	}
+	for _, feature := range cmd.Features {
+		if user.HasFeature(feature) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) usage(cmd *Command) string {
+	usage := r.prefix + cmd.Name
+	if cmd.Usage != "" {
+		usage += " " + cmd.Usage
+	}
+	if cmd.Description != "" {
+		usage += " - " + cmd.Description
+	}
+	if len(cmd.Aliases) > 0 {
+		usage += fmt.Sprintf(" (aliases: %s)", strings.Join(cmd.Aliases, ", "))
+	}
+	return usage
+}
+
+// Help returns the help text listing all commands the given user is allowed to use
+func (r *Router) Help(user dggchat.User) string {
+	r.Lock()
+	defer r.Unlock()
+
+	names := make([]string, 0, len(r.ordered))
+	for _, cmd := range r.ordered {
+		if allowed(cmd, user) {
+			names = append(names, r.prefix+cmd.Name)
+		}
+	}
+	return "Commands: " + strings.Join(names, " ")
+}
+
+func (r *Router) help(ctx *Context) {
+	if len(ctx.Args) > 0 {
+		cmd, ok := r.lookup(strings.TrimPrefix(ctx.Args[0], r.prefix))
+		if ok && allowed(cmd, ctx.Sender) {
+			_ = ctx.Reply(r.usage(cmd))
+			return
+		}
+	}
+	_ = ctx.Reply(r.Help(ctx.Sender))
+}
+
+// parseArgs splits s on whitespace, text enclosed in double quotes is kept as a single argument.
+func parseArgs(s string) []string {
+	var (
+		args    []string
+		current strings.Builder
+		quoted  bool
+		started bool
+	)
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if started {
+				args = append(args, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+	if started {
+		args = append(args, current.String())
+	}
+
+	return args
+}
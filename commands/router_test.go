@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/MemeLabs/dggchat/dggchattest"
+)
+
+func TestHistoryIgnored(t *testing.T) {
+	srv := dggchattest.NewServer()
+	defer srv.Close()
+	srv.SetHistory(`MSG {"nick":"alice","timestamp":1,"data":"!ping"}`)
+
+	s, _ := dggchat.New("")
+	s.SetAPIURL(srv.APIURL())
+
+	calls := 0
+	r := NewRouter("")
+	_ = r.Register(Command{Name: "ping", Handler: func(*Context) { calls++ }})
+	s.AddMessageHandler(r.HandleMessage)
+
+	if err := s.ReplayHistory(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("expected replayed command not to be handled, got %d calls", calls)
+	}
+
+	r.HandleMessage(dggchat.Message{Sender: dggchat.User{Nick: "alice"}, Message: "!ping"}, s)
+	if calls != 1 {
+		t.Errorf("expected live command to be handled, got %d calls", calls)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"ping", []string{"ping"}},
+		{"mute  alice\t10m", []string{"mute", "alice", "10m"}},
+		{`say "hello world" now`, []string{"say", "hello world", "now"}},
+		{`say ""`, []string{"say", ""}},
+		{`say "unterminated quote`, []string{"say", "unterminated quote"}},
+		{`say a"b c"d`, []string{"say", "ab cd"}},
+		{"multi\nline", []string{"multi", "line"}},
+	}
+	for _, tt := range tests {
+		if got := parseArgs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	s, _ := dggchat.New()
+	alice := dggchat.User{Nick: "alice"}
+	mod := dggchat.User{Nick: "mod", Features: []string{dggchat.FeatureModerator}}
+
+	calls := 0
+	r := NewRouter("!")
+	for _, c := range []Command{
+		{Name: "ping", Aliases: []string{"p"}, Handler: func(*Context) { calls++ }},
+		{Name: "mute", Features: []string{dggchat.FeatureModerator, dggchat.FeatureAdministrator}, MinArgs: 1, Handler: func(*Context) { calls++ }},
+	} {
+		if err := r.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		sender  dggchat.User
+		message string
+		called  bool
+	}{
+		{"command", alice, "!ping", true},
+		{"alias", alice, "!P", true},
+		{"no prefix", alice, "ping", false},
+		{"space after prefix", alice, "! ping", false},
+		{"unknown command", alice, "!pong", false},
+		{"missing feature", alice, "!mute bob", false},
+		{"one of the features", mod, "!mute bob", true},
+		{"missing arguments", mod, "!mute", false},
+	}
+	for _, tt := range tests {
+		calls = 0
+		r.HandleMessage(dggchat.Message{Sender: tt.sender, Message: tt.message}, s)
+		if called := calls == 1; called != tt.called {
+			t.Errorf("%s: %q called = %v, want %v", tt.name, tt.message, called, tt.called)
+		}
+	}
+
+	if err := r.Register(Command{Name: "other", Aliases: []string{"PING"}, Handler: func(*Context) {}}); err != ErrDuplicateCommand {
+		t.Errorf("expected ErrDuplicateCommand, got %v", err)
+	}
+	if err := r.Register(Command{Name: "nohandler"}); err != ErrInvalidCommand {
+		t.Errorf("expected ErrInvalidCommand, got %v", err)
+	}
+	if help := r.Help(alice); help != "Commands: !help !ping" {
+		t.Errorf("unexpected help for users %q", help)
+	}
+	if help := r.Help(mod); help != "Commands: !help !mute !ping" {
+		t.Errorf("unexpected help for moderators %q", help)
+	}
+}
+
+func TestCooldowns(t *testing.T) {
+	s, _ := dggchat.New()
+	alice := dggchat.User{Nick: "alice"}
+	bob := dggchat.User{Nick: "bob"}
+
+	now := time.Unix(0, 0)
+	var calls []string
+	r := NewRouter("!")
+	r.now = func() time.Time { return now }
+	_ = r.Register(Command{Name: "global", Cooldown: time.Minute, Handler: func(c *Context) { calls = append(calls, c.Sender.Nick) }})
+	_ = r.Register(Command{Name: "user", UserCooldown: time.Minute, MinArgs: 1, Handler: func(c *Context) { calls = append(calls, c.Sender.Nick) }})
+
+	steps := []struct {
+		after   time.Duration
+		sender  dggchat.User
+		message string
+		called  bool
+	}{
+		{0, alice, "!global", true},
+		{time.Second, bob, "!global", false},
+		{time.Minute, bob, "!global", true},
+		{0, alice, "!user", false},
+		// the invocation without arguments did not start the cooldown
+		{0, alice, "!user x", true},
+		{time.Second, alice, "!user x", false},
+		{0, bob, "!user x", true},
+		{time.Minute, alice, "!user x", true},
+	}
+	for i, step := range steps {
+		now = now.Add(step.after)
+		calls = nil
+		r.HandleMessage(dggchat.Message{Sender: step.sender, Message: step.message}, s)
+		if called := len(calls) == 1; called != step.called {
+			t.Errorf("step %d: %s %q called = %v, want %v", i, step.sender.Nick, step.message, called, step.called)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package dggchat
 
 import (
 	"errors"
+	"log/slog"
+	"net/http"
 	"net/url"
 	"os"
 
@@ -13,7 +15,11 @@ import (
 var ErrTooManyArgs = errors.New("function called with unexcepted amount of arguments")
 
 // New creates a new destinygg session. Accepts either 0 or 1 arguments.
-// If no login key is provided, a read-only session is returned
+// If no login key is provided, a read-only session is returned.
+// The session connects to DestinyGG, see *session.SetBackend() for other chats.
+// For compatibility, the CUSTOM_WSHOST and CUSTOM_ORIGINHEADER environment variables
+// override the websocket host, api host and origin header of DestinyGG. They do not apply
+// to backends set with *session.SetBackend(), which replaces them.
 func New(args ...string) (*Session, error) {
 
 	if len(args) > 1 {
@@ -23,16 +29,17 @@ func New(args ...string) (*Session, error) {
 		attempToReconnect: true,
 		state:             newState(),
 		dialer:            websocket.DefaultDialer,
+		backend:           DestinyGG,
+		httpClient:        http.DefaultClient,
 	}
 	customHost, customHostExist := os.LookupEnv("CUSTOM_WSHOST")
 	if customHostExist {
-		s.wsURL = url.URL{Scheme: "wss", Host: customHost, Path: "/ws"}
-	} else {
-		s.wsURL = wsURL
+		s.backend.URL = url.URL{Scheme: "wss", Host: customHost, Path: "/ws"}
+		s.backend.APIURL = url.URL{Scheme: "https", Host: customHost}
 	}
 	customOriginHeader, customOriginHeaderExist := os.LookupEnv("CUSTOM_ORIGINHEADER")
 	if customOriginHeaderExist {
-		s.originHeader = customOriginHeader
+		s.backend.Origin = customOriginHeader
 	}
 	if len(args) == 1 {
 		s.loginKey = args[0]
@@ -42,3 +49,38 @@ func New(args ...string) (*Session, error) {
 
 	return s, nil
 }
+
+// An Option configures a session created with NewWithOptions
+type Option func(*Session)
+
+// NewWithOptions creates a new destinygg session configured by the given options.
+// Without WithLoginKey, a read-only session is returned
+func NewWithOptions(opts ...Option) (*Session, error) {
+	s, err := New()
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// WithLoginKey logs the session in with the given login key.
+// An empty key does not change the session, so it stays read-only without other logins.
+func WithLoginKey(key string) Option {
+	return func(s *Session) {
+		if key == "" {
+			return
+		}
+		s.loginKey = key
+		s.readOnly = false
+	}
+}
+
+// WithLogger sets the logger of the session, see *session.SetLogger()
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Session) {
+		s.SetLogger(l)
+	}
+}
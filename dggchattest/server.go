@@ -0,0 +1,480 @@
+// Package dggchattest provides an in-process chat server speaking the destinygg
+// chat protocol, for testing code built on dggchat without the live server.
+//
+//	srv := dggchattest.NewServer()
+//	defer srv.Close()
+//	srv.SetMe(dggchat.User{Nick: "bot"})
+//
+//	// any login key is accepted
+//	s, _ := dggchat.New("key")
+//	s.SetURL(srv.URL())
+//	s.SetAPIURL(srv.APIURL())
+//	err := s.Open()
+package dggchattest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/MemeLabs/dggchat/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// Frame is a protocol message received from a client
+type Frame struct {
+	Type    string
+	Payload string
+}
+
+// Unmarshal decodes the json payload of the frame into v
+func (f Frame) Unmarshal(v interface{}) error {
+	return json.Unmarshal([]byte(f.Payload), v)
+}
+
+type client struct {
+	sync.Mutex
+	ws          *websocket.Conn
+	lastMessage string
+	lastSent    time.Time
+}
+
+func (c *client) write(frame string) error {
+	c.Lock()
+	defer c.Unlock()
+	return c.ws.WriteMessage(websocket.TextMessage, []byte(frame))
+}
+
+// A Server is a fake chat server. Clients connect to the websocket at URL(),
+// the http api is served at APIURL().
+//
+// When connecting, clients receive a NAMES message with the users set with SetUsers.
+// Clients sending a cookie are logged in as DefaultMe, or the user set with SetMe.
+// Messages sent by them are echoed to all clients as coming from that user,
+// and duplicate messages are rejected like the real server does.
+type Server struct {
+	sync.Mutex
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+	clients  map[*client]struct{}
+	users    []dggchat.User
+	me       dggchat.User
+	throttle time.Duration
+	received []Frame
+	history  []string
+	headers  []http.Header
+	notify   chan struct{}
+}
+
+// DefaultMe is the user logged in clients are logged in as, unless changed with SetMe
+var DefaultMe = dggchat.User{Nick: "tester"}
+
+// NewServer starts a new server, it should be closed with Close when done
+func NewServer() *Server {
+	s := &Server{
+		clients: make(map[*client]struct{}),
+		users:   make([]dggchat.User, 0),
+		me:      DefaultMe,
+		notify:  make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.serveWS)
+	mux.HandleFunc("/api/chat/me", s.serveMe)
+	mux.HandleFunc("/api/chat/history", s.serveHistory)
+	s.srv = httptest.NewServer(mux)
+	return s
+}
+
+// URL returns the websocket url to pass to *session.SetURL()
+func (s *Server) URL() url.URL {
+	u, _ := url.Parse(s.srv.URL)
+	return url.URL{Scheme: "ws", Host: u.Host, Path: "/ws"}
+}
+
+// APIURL returns the http api url to pass to *session.SetAPIURL()
+func (s *Server) APIURL() url.URL {
+	u, _ := url.Parse(s.srv.URL)
+	return url.URL{Scheme: "http", Host: u.Host}
+}
+
+// Close drops all connections and stops the server
+func (s *Server) Close() {
+	s.DropConnections()
+	s.srv.Close()
+}
+
+// SetUsers sets the users sent in the NAMES message to connecting clients
+func (s *Server) SetUsers(users ...dggchat.User) {
+	s.Lock()
+	defer s.Unlock()
+	s.users = users
+}
+
+// SetMe sets the user returned by the api for logged in clients.
+// It is added to the users sent in the NAMES message as well.
+func (s *Server) SetMe(user dggchat.User) {
+	s.Lock()
+	defer s.Unlock()
+	s.me = user
+}
+
+// SetHistory sets the raw frames returned by the chat history api, oldest first
+func (s *Server) SetHistory(frames ...string) {
+	s.Lock()
+	defer s.Unlock()
+	s.history = frames
+}
+
+// SetThrottle makes the server reply with dggchat.ErrorThorttled to clients sending
+// messages less than interval apart. An interval of 0 disables throttling.
+func (s *Server) SetThrottle(interval time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.throttle = interval
+}
+
+// Connections returns the number of connected clients
+func (s *Server) Connections() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.clients)
+}
+
+// Headers returns the http headers of all websocket handshakes, oldest first
+func (s *Server) Headers() []http.Header {
+	s.Lock()
+	defer s.Unlock()
+	h := make([]http.Header, len(s.headers))
+	copy(h, s.headers)
+	return h
+}
+
+// Received returns all frames sent by clients, oldest first
+func (s *Server) Received() []Frame {
+	s.Lock()
+	defer s.Unlock()
+	f := make([]Frame, len(s.received))
+	copy(f, s.received)
+	return f
+}
+
+// WaitForFrame waits until a client has sent a frame of the given type, and returns
+// the first one. Frames received before calling WaitForFrame are included.
+func (s *Server) WaitForFrame(ctx context.Context, mType string) (Frame, error) {
+	for {
+		s.Lock()
+		notify := s.notify
+		for _, f := range s.received {
+			if f.Type == mType {
+				s.Unlock()
+				return f, nil
+			}
+		}
+		s.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Frame{}, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// WaitForConnections waits until at least n clients are connected
+func (s *Server) WaitForConnections(ctx context.Context, n int) error {
+	for {
+		s.Lock()
+		notify := s.notify
+		connected := len(s.clients)
+		s.Unlock()
+
+		if connected >= n {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// DropConnections closes the connections of all clients, without a close message
+func (s *Server) DropConnections() {
+	s.Lock()
+	defer s.Unlock()
+	for c := range s.clients {
+		_ = c.ws.Close()
+	}
+}
+
+// SendRaw sends the raw frame, e.g. `ERR "muted"`, to all clients
+func (s *Server) SendRaw(frame string) {
+	s.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.Unlock()
+
+	for _, c := range clients {
+		_ = c.write(frame)
+	}
+}
+
+// Send sends a frame of the given type with v encoded as json to all clients
+func (s *Server) Send(mType string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.SendRaw(fmt.Sprintf("%s %s", mType, payload))
+	return nil
+}
+
+// SendEvent encodes the event and sends it to all clients, see protocol.Encode
+func (s *Server) SendEvent(e dggchat.Event) error {
+	frame, err := protocol.Encode(e)
+	if err != nil {
+		return err
+	}
+	s.SendRaw(string(frame))
+	return nil
+}
+
+// SendMessage sends a chat message from the given user to all clients
+func (s *Server) SendMessage(from dggchat.User, message string) error {
+	return s.SendEvent(dggchat.Event{Data: dggchat.Message{
+		Sender:    from,
+		Timestamp: time.Now(),
+		Message:   message,
+	}})
+}
+
+// SendJoin announces that the user joined and adds them to the users sent to new clients
+func (s *Server) SendJoin(user dggchat.User) error {
+	s.Lock()
+	s.users = append(s.users, user)
+	s.Unlock()
+	return s.SendEvent(dggchat.Event{
+		Type: protocol.TypeJoin,
+		Data: dggchat.RoomAction{User: user, Timestamp: time.Now()},
+	})
+}
+
+// SendQuit announces that the user left and removes them from the users sent to new clients
+func (s *Server) SendQuit(user dggchat.User) error {
+	s.Lock()
+	for i, u := range s.users {
+		if strings.EqualFold(u.Nick, user.Nick) {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+			break
+		}
+	}
+	s.Unlock()
+	return s.SendEvent(dggchat.Event{
+		Type: protocol.TypeQuit,
+		Data: dggchat.RoomAction{User: user, Timestamp: time.Now()},
+	})
+}
+
+// SendMute announces that the moderator muted the target nick
+func (s *Server) SendMute(moderator dggchat.User, target string) error {
+	return s.SendEvent(dggchat.Event{Data: dggchat.Mute{
+		Sender:    moderator,
+		Timestamp: time.Now(),
+		Target:    dggchat.User{Nick: target},
+	}})
+}
+
+// SendBan announces that the moderator banned the target nick
+func (s *Server) SendBan(moderator dggchat.User, target string) error {
+	return s.SendEvent(dggchat.Event{Data: dggchat.Ban{
+		Sender:    moderator,
+		Timestamp: time.Now(),
+		Target:    dggchat.User{Nick: target},
+	}})
+}
+
+// SendPrivateMessage sends a private message from the given nick to all clients
+func (s *Server) SendPrivateMessage(from string, message string) error {
+	return s.SendEvent(dggchat.Event{Data: dggchat.PrivateMessage{
+		User:      dggchat.User{Nick: from},
+		Message:   message,
+		Timestamp: time.Now(),
+		ID:        1,
+	}})
+}
+
+// SendError sends an error, e.g. dggchat.ErrorMuted, to all clients
+func (s *Server) SendError(description string) error {
+	return s.SendEvent(dggchat.Event{Type: protocol.TypeError, Data: description})
+}
+
+// SendRefresh sends a REFRESH for the given user, which makes clients reconnect.
+// Like the real server, the connections are closed afterwards.
+func (s *Server) SendRefresh(user dggchat.User) error {
+	if err := s.SendEvent(dggchat.Event{Type: protocol.TypeRefresh, Data: user}); err != nil {
+		return err
+	}
+	s.DropConnections()
+	return nil
+}
+
+func (s *Server) serveMe(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	me := s.me
+	s.Unlock()
+
+	if r.Header.Get("Cookie") == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"nick":     me.Nick,
+		"features": me.Features,
+	})
+}
+
+func (s *Server) serveHistory(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	history := make([]string, len(s.history))
+	copy(history, s.history)
+	s.Unlock()
+
+	_ = json.NewEncoder(w).Encode(history)
+}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &client{ws: ws}
+
+	s.Lock()
+	s.headers = append(s.headers, r.Header.Clone())
+	users := make([]dggchat.User, len(s.users))
+	copy(users, s.users)
+	if r.Header.Get("Cookie") != "" {
+		users = append(users, s.me)
+	}
+	s.clients[c] = struct{}{}
+	connections := len(s.clients)
+	s.changed()
+	s.Unlock()
+
+	names, _ := protocol.Encode(dggchat.Event{Data: dggchat.Names{Connections: connections, Users: users}})
+	_ = c.write(string(names))
+
+	defer func() {
+		s.Lock()
+		delete(s.clients, c)
+		s.changed()
+		s.Unlock()
+		_ = ws.Close()
+	}()
+
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		mslice := strings.SplitN(string(message), " ", 2)
+		if len(mslice) != 2 {
+			_ = c.write(`ERR "protocolerror"`)
+			continue
+		}
+		s.handle(c, Frame{Type: mslice[0], Payload: mslice[1]}, r.Header.Get("Cookie") != "")
+	}
+}
+
+// handle records a frame sent by a client and answers it like the real server
+func (s *Server) handle(c *client, f Frame, loggedIn bool) {
+	s.Lock()
+	s.received = append(s.received, f)
+	s.changed()
+	throttle := s.throttle
+	me := s.me
+	s.Unlock()
+
+	if f.Type == protocol.TypePing {
+		var p dggchat.Ping
+		_ = f.Unmarshal(&p)
+		pong, _ := protocol.Encode(dggchat.Event{Data: p})
+		_ = c.write(string(pong))
+		return
+	}
+	if !loggedIn {
+		_ = c.write(`ERR "needlogin"`)
+		return
+	}
+
+	c.Lock()
+	now := time.Now()
+	throttled := throttle > 0 && now.Sub(c.lastSent) < throttle
+	c.lastSent = now
+	c.Unlock()
+	if throttled {
+		_ = c.write(`ERR "throttled"`)
+		return
+	}
+
+	var out struct {
+		Data string `json:"data"`
+		Nick string `json:"nick"`
+		// Duration of mutes and bans is sent in nanoseconds, like the server expects it
+		Duration int64 `json:"duration"`
+	}
+	_ = f.Unmarshal(&out)
+
+	now = time.Now()
+	target := dggchat.User{Nick: out.Data}
+
+	switch f.Type {
+	case protocol.TypeMessage:
+		c.Lock()
+		duplicate := strings.EqualFold(c.lastMessage, out.Data)
+		c.lastMessage = out.Data
+		c.Unlock()
+		if duplicate {
+			_ = c.write(`ERR "duplicate"`)
+			return
+		}
+		_ = s.SendMessage(me, out.Data)
+	case protocol.TypePrivateMessage:
+		_ = c.write(`PRIVMSGSENT ""`)
+	case protocol.TypeMute:
+		d := time.Duration(out.Duration)
+		if d <= 0 {
+			d = dggchat.DefaultMuteDuration
+		}
+		_ = s.SendEvent(dggchat.Event{Data: dggchat.Mute{Sender: me, Timestamp: now, Target: target, Duration: d}})
+	case protocol.TypeUnmute:
+		_ = s.SendEvent(dggchat.Event{Type: f.Type, Data: dggchat.Mute{Sender: me, Timestamp: now, Target: target}})
+	case protocol.TypeUnban:
+		_ = s.SendEvent(dggchat.Event{Type: f.Type, Data: dggchat.Ban{Sender: me, Timestamp: now, Target: target}})
+	case protocol.TypeBan:
+		target.Nick = out.Nick
+		_ = s.SendEvent(dggchat.Event{Type: f.Type, Data: dggchat.Ban{Sender: me, Timestamp: now, Target: target}})
+	case protocol.TypeSubOnly:
+		_ = s.SendEvent(dggchat.Event{Data: dggchat.SubOnly{Sender: me, Timestamp: now, Active: out.Data == "on"}})
+	case protocol.TypeBroadcast:
+		_ = s.SendEvent(dggchat.Event{Data: dggchat.Broadcast{Sender: me, Timestamp: now, Message: out.Data}})
+	}
+}
+
+// changed wakes up everybody waiting for frames or connections.
+// call with locks held
+func (s *Server) changed() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
@@ -0,0 +1,180 @@
+package dggchattest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// connect opens a session to the server and returns a channel receiving its events
+func connect(t *testing.T, srv *Server, key string) (*dggchat.Session, chan dggchat.Event) {
+	t.Helper()
+	var keys []string
+	if key != "" {
+		keys = append(keys, key)
+	}
+	s, _ := dggchat.New(keys...)
+	s.SetURL(srv.URL())
+	s.SetAPIURL(srv.APIURL())
+
+	events := make(chan dggchat.Event, 100)
+	s.AddEventListener(func(e dggchat.Event, _ *dggchat.Session) {
+		events <- e
+	})
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s, events
+}
+
+// next returns the next event of the given type
+func next(t *testing.T, events chan dggchat.Event, mType string) dggchat.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type == mType {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", mType)
+		}
+	}
+}
+
+func TestServerLogin(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetUsers(dggchat.User{Nick: "alice"})
+
+	s, events := connect(t, srv, "key")
+	names := next(t, events, "NAMES").Data.(dggchat.Names)
+	if len(names.Users) != 2 || names.Users[1].Nick != DefaultMe.Nick {
+		t.Errorf("expected NAMES to contain the users and our own user, got %+v", names.Users)
+	}
+	if me, ok := s.Me(); !ok || me.Nick != DefaultMe.Nick {
+		t.Errorf("expected to be logged in as %s, got %+v", DefaultMe.Nick, me)
+	}
+	if h := srv.Headers(); len(h) != 1 || h[0].Get("Cookie") != "authtoken=key" {
+		t.Errorf("unexpected handshake headers %v", h)
+	}
+
+	srv.SetMe(dggchat.User{Nick: "bot"})
+	other, _ := connect(t, srv, "key")
+	if me, _ := other.Me(); me.Nick != "bot" {
+		t.Errorf("expected to be logged in as bot, got %+v", me)
+	}
+
+	anonymous, events := connect(t, srv, "")
+	names = next(t, events, "NAMES").Data.(dggchat.Names)
+	if len(names.Users) != 1 {
+		t.Errorf("expected anonymous clients not to be in NAMES, got %+v", names.Users)
+	}
+	if _, ok := anonymous.Me(); ok {
+		t.Error("expected anonymous clients not to know their user")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.WaitForConnections(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerMessages(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetMe(dggchat.User{Nick: "mod", Features: []string{dggchat.FeatureModerator}})
+	s, events := connect(t, srv, "key")
+
+	if err := s.SendMessage("hello"); err != nil {
+		t.Fatal(err)
+	}
+	m := next(t, events, "MSG").Data.(dggchat.Message)
+	if m.Sender.Nick != "mod" || m.Message != "hello" {
+		t.Errorf("expected message to be echoed, got %+v", m)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if f, err := srv.WaitForFrame(ctx, "MSG"); err != nil || f.Payload != `{"data":"hello"}` {
+		t.Errorf("unexpected frame %+v (%v)", f, err)
+	}
+
+	_ = s.SendMessage("HELLO")
+	if e := next(t, events, "ERR"); e.Data != dggchat.ErrorDuplicate {
+		t.Errorf("expected duplicate error, got %v", e.Data)
+	}
+
+	srv.SetThrottle(time.Hour)
+	_ = s.SendMessage("one")
+	_ = s.SendMessage("two")
+	if e := next(t, events, "ERR"); e.Data != dggchat.ErrorThorttled {
+		t.Errorf("expected throttled error, got %v", e.Data)
+	}
+	srv.SetThrottle(0)
+
+	_ = s.SendMute("alice", 0)
+	mute := next(t, events, "MUTE").Data.(dggchat.Mute)
+	if mute.Target.Nick != "alice" || mute.Duration != dggchat.DefaultMuteDuration {
+		t.Errorf("expected mute with the default duration, got %+v", mute)
+	}
+	_ = s.SendMute("bob", time.Minute)
+	if mute := next(t, events, "MUTE").Data.(dggchat.Mute); mute.Duration != time.Minute {
+		t.Errorf("expected mute with the given duration, got %+v", mute)
+	}
+
+	if err := srv.SendJoin(dggchat.User{Nick: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+	next(t, events, "JOIN")
+	if _, ok := s.GetUser("carol"); !ok {
+		t.Error("expected joined user to be in chat")
+	}
+	_ = srv.SendQuit(dggchat.User{Nick: "carol"})
+	next(t, events, "QUIT")
+	if _, ok := s.GetUser("carol"); ok {
+		t.Error("expected user to have left chat")
+	}
+
+	_ = srv.SendPrivateMessage("alice", "psst")
+	if pm := next(t, events, "PRIVMSG").Data.(dggchat.PrivateMessage); pm.User.Nick != "alice" || pm.Message != "psst" {
+		t.Errorf("unexpected private message %+v", pm)
+	}
+}
+
+func TestServerHistory(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetHistory(`MSG {"nick":"alice","data":"earlier","timestamp":1}`)
+
+	s, _ := dggchat.New()
+	s.SetAPIURL(srv.APIURL())
+	history, err := s.FetchHistory(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Data.(dggchat.Message).Message != "earlier" {
+		t.Errorf("unexpected history %+v", history)
+	}
+}
+
+func TestServerRefresh(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	_, events := connect(t, srv, "key")
+	next(t, events, "NAMES")
+
+	if err := srv.SendRefresh(DefaultMe); err != nil {
+		t.Fatal(err)
+	}
+	next(t, events, "REFRESH")
+	// the client reconnects and receives NAMES again
+	next(t, events, "NAMES")
+	if n := len(srv.Headers()); n != 2 {
+		t.Errorf("expected the client to reconnect once, got %d handshakes", n)
+	}
+}
@@ -0,0 +1,110 @@
+package dggchat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DuplicatePolicy decides what happens when sending a chat message equal to the previous one.
+// The server rejects such messages with ErrorDuplicate.
+type DuplicatePolicy int
+
+// Supported duplicate policies
+const (
+	// DuplicateAllow sends repeated messages unchanged, this is the default
+	DuplicateAllow DuplicatePolicy = iota
+	// DuplicateReject returns ErrDuplicate instead of sending a repeated message
+	DuplicateReject
+	// DuplicateInvisible makes a repeated message unique by appending an invisible character
+	DuplicateInvisible
+	// DuplicateCounter makes a repeated message unique by appending a counter, e.g. "message (2)"
+	DuplicateCounter
+)
+
+// ErrDuplicate is thrown when attempting to send the same message twice in a row
+// while the duplicate policy is DuplicateReject.
+var ErrDuplicate = errors.New("message is equal to the previous message")
+
+type lastMessage struct {
+	// original is the message as it was passed to the session
+	original string
+	// sent is the message as it was sent to the server
+	sent    string
+	repeats int
+}
+
+// SetDuplicatePolicy changes how repeated chat messages are handled.
+func (s *Session) SetDuplicatePolicy(policy DuplicatePolicy) {
+	s.Lock()
+	defer s.Unlock()
+	s.duplicatePolicy = policy
+}
+
+// reserveMessage returns the message that should be sent instead of message, according to the
+// duplicate policy, and records it as the last message right away, so concurrent sends see it.
+// The previous last message is returned to undo the reservation if sending fails.
+func (s *Session) reserveMessage(message string) (lastMessage, lastMessage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	previous := s.lastMessage
+	reserved := lastMessage{original: message, sent: message}
+	if strings.EqualFold(message, previous.original) {
+		reserved.repeats = previous.repeats + 1
+	}
+
+	switch s.duplicatePolicy {
+	case DuplicateReject:
+		if strings.EqualFold(message, previous.sent) {
+			return lastMessage{}, previous, ErrDuplicate
+		}
+	case DuplicateInvisible:
+		if strings.EqualFold(message, previous.sent) {
+			reserved.sent = withSuffix(message, repeatMarker)
+		}
+	case DuplicateCounter:
+		if reserved.repeats > 0 {
+			reserved.sent = withSuffix(message, fmt.Sprintf(" (%d)", reserved.repeats+1))
+		}
+	}
+
+	s.lastMessage = reserved
+	return reserved, previous, nil
+}
+
+// releaseMessage undoes the reservation of a message that could not be sent,
+// unless another message was reserved since.
+func (s *Session) releaseMessage(reserved lastMessage, previous lastMessage) {
+	s.Lock()
+	defer s.Unlock()
+	if s.lastMessage == reserved {
+		s.lastMessage = previous
+	}
+}
+
+// withSuffix appends suffix to message, shortening the message if it would no longer
+// fit into MaxMessageLength. Messages that are too long already are not shortened.
+func withSuffix(message string, suffix string) string {
+	length := utf8.RuneCountInString(message)
+	limit := MaxMessageLength - utf8.RuneCountInString(suffix)
+	if length <= MaxMessageLength && length > limit {
+		message = string([]rune(message)[:limit])
+	}
+	return message + suffix
+}
+
+// sendChatMessage sends message to chat, applying the duplicate policy.
+func (s *Session) sendChatMessage(message string, interval time.Duration) error {
+	reserved, previous, err := s.reserveMessage(message)
+	if err != nil {
+		return err
+	}
+	if err := s.sendWithInterval(messageOut{Data: reserved.sent}, "MSG", interval); err != nil {
+		s.releaseMessage(reserved, previous)
+		return err
+	}
+	return nil
+}
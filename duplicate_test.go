@@ -0,0 +1,111 @@
+package dggchat
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDuplicatePolicy(t *testing.T) {
+	tests := []struct {
+		policy   DuplicatePolicy
+		messages []string
+		want     []string
+	}{
+		{DuplicateAllow, []string{"hi", "hi"}, []string{"hi", "hi"}},
+		{DuplicateReject, []string{"hi", "HI", "yo", "hi"}, []string{"hi", "", "yo", "hi"}},
+		{DuplicateInvisible, []string{"hi", "hi", "hi"}, []string{"hi", "hi" + repeatMarker, "hi"}},
+		{DuplicateCounter, []string{"hi", "hi", "Hi", "yo", "hi"}, []string{"hi", "hi (2)", "Hi (3)", "yo", "hi"}},
+	}
+	for _, tt := range tests {
+		s, _ := New("key")
+		s.SetDuplicatePolicy(tt.policy)
+		for i, message := range tt.messages {
+			reserved, _, err := s.reserveMessage(message)
+			if tt.want[i] == "" {
+				if !errors.Is(err, ErrDuplicate) {
+					t.Errorf("policy %d: expected %q to be rejected, got %v", tt.policy, message, err)
+				}
+				continue
+			}
+			if err != nil || reserved.sent != tt.want[i] {
+				t.Errorf("policy %d: message %d sent as %q (%v), want %q", tt.policy, i, reserved.sent, err, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestDuplicateRelease(t *testing.T) {
+	s, _ := New("key")
+	s.SetDuplicatePolicy(DuplicateReject)
+
+	_, _, _ = s.reserveMessage("hi")
+	second, previous, err := s.reserveMessage("yo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.releaseMessage(second, previous)
+	if _, _, err := s.reserveMessage("hi"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected the released message to be forgotten, got %v", err)
+	}
+
+	// a release after another reservation keeps the newer one
+	first, previous, _ := s.reserveMessage("a")
+	_, _, _ = s.reserveMessage("b")
+	s.releaseMessage(first, previous)
+	if _, _, err := s.reserveMessage("b"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected the newer reservation to be kept, got %v", err)
+	}
+}
+
+func TestDuplicateConcurrent(t *testing.T) {
+	s, _ := New("key")
+	s.SetDuplicatePolicy(DuplicateReject)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := s.reserveMessage("hi"); err == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 1 {
+		t.Errorf("expected a single concurrent message to be sent, got %d", reserved)
+	}
+}
+
+func TestDuplicateLength(t *testing.T) {
+	s, _ := New("key")
+	s.SetDuplicatePolicy(DuplicateCounter)
+
+	long := strings.Repeat("ä", MaxMessageLength)
+	_, _, _ = s.reserveMessage(long)
+	reserved, _, _ := s.reserveMessage(long)
+	if n := utf8.RuneCountInString(reserved.sent); n != MaxMessageLength || !strings.HasSuffix(reserved.sent, " (2)") {
+		t.Errorf("expected the message to be shortened to fit the counter, got %d characters", n)
+	}
+
+	tooLong := strings.Repeat("a", MaxMessageLength+10)
+	_, _, _ = s.reserveMessage(tooLong)
+	reserved, _, _ = s.reserveMessage(tooLong)
+	if reserved.sent != tooLong+" (2)" {
+		t.Error("expected messages that are too long already not to be shortened")
+	}
+
+	s.SetDuplicatePolicy(DuplicateInvisible)
+	reserved, _, _ = s.reserveMessage(long)
+	reserved, _, _ = s.reserveMessage(long)
+	if n := utf8.RuneCountInString(reserved.sent); n != MaxMessageLength || !strings.HasSuffix(reserved.sent, repeatMarker) {
+		t.Errorf("expected the message to be shortened to fit the marker, got %d characters", n)
+	}
+}
@@ -0,0 +1,173 @@
+package dggchat
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MemeLabs/dggchat/internal/codec"
+)
+
+// the protocol package exposes encoding and decoding
+func init() {
+	codec.Encode = func(e interface{}) ([]byte, error) {
+		event, ok := e.(Event)
+		if !ok {
+			return nil, codec.ErrUnknownEvent
+		}
+		return encodeEvent(event)
+	}
+	codec.Decode = func(frame []byte) (interface{}, error) {
+		return decodeEvent(frame)
+	}
+}
+
+// encodeEvent serializes an event into a protocol message, as the server would send it,
+// e.g. `MSG {"nick":"Destiny",...}`. If the type of the event is empty, it is derived from its data.
+// Events without data are encoded using their payload.
+func encodeEvent(e Event) ([]byte, error) {
+	mType := e.Type
+	if mType == "" {
+		mType = eventType(e.Data)
+	}
+	if mType == "" {
+		return nil, codec.ErrUnknownEvent
+	}
+
+	var payload interface{}
+	switch data := e.Data.(type) {
+	case nil:
+		return []byte(fmt.Sprintf("%s %s", mType, e.Payload)), nil
+	case Message:
+		payload = message{User: data.Sender, Timestamp: timeToUnix(data.Timestamp), Data: data.Message}
+	case Pin:
+		payload = pin{User: data.Sender, UUID: data.UUID, Data: data.Message, Timestamp: timeToUnix(data.Timestamp)}
+	case Mute:
+		payload = mute{
+			message:  message{User: data.Sender, Timestamp: timeToUnix(data.Timestamp), Data: data.Target.Nick},
+			Duration: int64(data.Duration / time.Second),
+		}
+	case Ban:
+		payload = message{User: data.Sender, Timestamp: timeToUnix(data.Timestamp), Data: data.Target.Nick}
+	case Names:
+		payload = data
+	case RoomAction:
+		payload = roomAction{User: data.User, Timestamp: timeToUnix(data.Timestamp)}
+	case User:
+		payload = data
+	case PrivateMessage:
+		payload = privateMessage{
+			MessageID: data.ID,
+			Timestamp: timeToUnix(data.Timestamp),
+			Nick:      data.User.Nick,
+			Data:      data.Message,
+		}
+	case Broadcast:
+		payload = broadcast{User: data.Sender, Data: data.Message, UUID: data.UUID, Timestamp: timeToUnix(data.Timestamp)}
+	case Subscription:
+		sub := subscription{
+			Data:      data.Message,
+			Timestamp: timeToUnix(data.Timestamp),
+			Nick:      data.Sender.Nick,
+			Tier:      data.Tier.Tier,
+			TierLabel: data.Tier.Label,
+			Quantity:  data.Quantity,
+			User:      data.Sender,
+			UUID:      data.UUID,
+		}
+		if data.IsGift() {
+			sub.Giftee = data.Recipient.Nick
+			sub.Recipient = data.Recipient
+		}
+		payload = sub
+	case Donation:
+		payload = donation{
+			Data:      data.Message,
+			Timestamp: timeToUnix(data.Timestamp),
+			Nick:      data.Sender.Nick,
+			Amount:    data.Amount,
+			User:      data.Sender,
+			UUID:      data.UUID,
+		}
+	case Ping:
+		// pongs are sent as base64 encoded json string
+		p, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		payload = base64.StdEncoding.EncodeToString(p)
+	case SubOnly:
+		so := subOnly{User: data.Sender, Data: "off", Timestamp: timeToUnix(data.Timestamp)}
+		if data.Active {
+			so.Data = "on"
+		}
+		payload = so
+	case string:
+		payload = data
+	default:
+		return nil, codec.ErrUnknownEvent
+	}
+
+	p, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s %s", mType, p)), nil
+}
+
+// decodeEvent parses a protocol message received from the server into an event.
+// Unlike messages dispatched by a session, targets of mutes and bans and senders
+// of private messages are not looked up in the chat room state, only their nick is known.
+func decodeEvent(frame []byte) (Event, error) {
+	mType, mContent, ok := splitFrame(frame)
+	if !ok {
+		return Event{}, codec.ErrMalformedFrame
+	}
+
+	data, err := parseEvent(mType, mContent, nil)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Type:    mType,
+		Data:    data,
+		Payload: mContent,
+	}, nil
+}
+
+// eventType returns the default message type for the given event data
+func eventType(data interface{}) string {
+	switch data.(type) {
+	case Message:
+		return "MSG"
+	case Pin:
+		return "PIN"
+	case Mute:
+		return "MUTE"
+	case Ban:
+		return "BAN"
+	case Names:
+		return "NAMES"
+	case RoomAction:
+		return "JOIN"
+	case User:
+		return "UPDATEUSER"
+	case PrivateMessage:
+		return "PRIVMSG"
+	case Broadcast:
+		return "BROADCAST"
+	case Subscription:
+		return "SUBSCRIPTION"
+	case Donation:
+		return "DONATION"
+	case Ping:
+		return "PONG"
+	case SubOnly:
+		return "SUBONLY"
+	case string:
+		return "ERR"
+	}
+	return ""
+}
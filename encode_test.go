@@ -0,0 +1,65 @@
+package dggchat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MemeLabs/dggchat/internal/codec"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for name, frame := range readFrames(t) {
+		t.Run(name, func(t *testing.T) {
+			e, err := decodeEvent(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encoded, err := encodeEvent(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := decodeEvent(encoded)
+			if err != nil {
+				t.Fatalf("decoding %s: %v", encoded, err)
+			}
+			if decoded.Type != e.Type {
+				t.Errorf("expected type %s, got %s", e.Type, decoded.Type)
+			}
+			if !reflect.DeepEqual(decoded.Data, e.Data) {
+				t.Errorf("round trip changed data:\ngot:  %+v\nwant: %+v", decoded.Data, e.Data)
+			}
+		})
+	}
+}
+
+func TestEncodeEventType(t *testing.T) {
+	tests := []struct {
+		data interface{}
+		want string
+	}{
+		{Message{Message: "hi"}, "MSG"},
+		{Ban{Target: User{Nick: "alice"}}, "BAN"},
+		{ErrorDuplicate, "ERR"},
+		{Ping{Timestamp: 1}, "PONG"},
+	}
+
+	for _, tt := range tests {
+		b, err := encodeEvent(Event{Data: tt.data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := decodeEvent(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != tt.want {
+			t.Errorf("expected %T to be encoded as %s, got %s", tt.data, tt.want, b)
+		}
+	}
+
+	if _, err := encodeEvent(Event{Data: 42}); err != codec.ErrUnknownEvent {
+		t.Errorf("expected ErrUnknownEvent, got %v", err)
+	}
+}
@@ -1,7 +1,13 @@
 package dggchat
 
+import (
+	"sync"
+	"time"
+)
+
 type handlers struct {
 	msgHandler          func(Message, *Session)
+	mentionHandler      func(Message, *Session)
 	pinHandler          func(Pin, *Session)
 	namesHandler        func(Names, *Session)
 	muteHandler         func(Mute, *Session)
@@ -27,6 +33,12 @@ func (s *Session) AddMessageHandler(fn func(Message, *Session)) {
 	s.handlers.msgHandler = fn
 }
 
+// AddMentionHandler adds a function that will be called every time a message mentions our nick,
+// or one of the keywords set with SetMentionKeywords
+func (s *Session) AddMentionHandler(fn func(Message, *Session)) {
+	s.handlers.mentionHandler = fn
+}
+
 // AddPinHandler adds a function that will be called every time a pin message is received
 func (s *Session) AddPinHandler(fn func(Pin, *Session)) {
 	s.handlers.pinHandler = fn
@@ -111,3 +123,158 @@ func (s *Session) AddSubOnlyHandler(fn func(SubOnly, *Session)) {
 func (s *Session) AddSocketErrorHandler(fn func(error, *Session)) {
 	s.handlers.socketErrorHandler = fn
 }
+
+// Event is a message received from the chat server
+type Event struct {
+	// Type is the message type used by the protocol, e.g. "MSG" or "BAN"
+	Type string
+	// Data is the parsed message, e.g. a Message for "MSG" or a Ban for "BAN".
+	// Errors ("ERR") are passed as the error description string.
+	// Data is nil for types without content, unknown types, and if parsing failed.
+	Data interface{}
+	// Payload is the unparsed json content of the message
+	Payload string
+	// Received is the time the message was received
+	Received time.Time
+	// Err is set if the message could not be parsed
+	Err error
+	// Historical is set for events replayed from the chat history, see *session.ReplayHistory()
+	Historical bool
+}
+
+type listeners struct {
+	sync.Mutex
+	next int
+	fns  map[int]func(Event)
+}
+
+// AddEventListener adds a function that will be called for every message received, in addition to the handlers.
+// Unlike handlers, any number of listeners can be added. The returned function removes the listener again.
+func (s *Session) AddEventListener(fn func(Event, *Session)) func() {
+	return s.addListener(func(e Event) {
+		fn(e, s)
+	})
+}
+
+// addListener registers fn to be called for every event, in addition to the handlers.
+// The returned function removes the listener again.
+func (s *Session) addListener(fn func(Event)) func() {
+	s.listeners.Lock()
+	defer s.listeners.Unlock()
+
+	if s.listeners.fns == nil {
+		s.listeners.fns = make(map[int]func(Event))
+	}
+	id := s.listeners.next
+	s.listeners.next++
+	s.listeners.fns[id] = fn
+
+	return func() {
+		s.listeners.Lock()
+		defer s.listeners.Unlock()
+		delete(s.listeners.fns, id)
+	}
+}
+
+func (s *Session) emit(e Event) {
+	s.listeners.Lock()
+	fns := make([]func(Event), 0, len(s.listeners.fns))
+	for _, fn := range s.listeners.fns {
+		fns = append(fns, fn)
+	}
+	s.listeners.Unlock()
+
+	for _, fn := range fns {
+		fn(e)
+	}
+}
+
+// callHandler calls the handler matching the type of the event, if one was added
+func (s *Session) callHandler(e Event) {
+	switch data := e.Data.(type) {
+	case Message:
+		if s.handlers.msgHandler != nil {
+			s.handlers.msgHandler(data, s)
+		}
+		if s.handlers.mentionHandler != nil && !data.Historical && s.isMention(data) {
+			s.handlers.mentionHandler(data, s)
+		}
+
+	case Pin:
+		if s.handlers.pinHandler != nil {
+			s.handlers.pinHandler(data, s)
+		}
+
+	case Subscription:
+		if s.handlers.subscriptionHandler != nil {
+			s.handlers.subscriptionHandler(data, s)
+		}
+
+	case Donation:
+		if s.handlers.donationHandler != nil {
+			s.handlers.donationHandler(data, s)
+		}
+
+	case Mute:
+		fn := s.handlers.muteHandler
+		if e.Type == "UNMUTE" {
+			fn = s.handlers.unmuteHandler
+		}
+		if fn != nil {
+			fn(data, s)
+		}
+
+	case Ban:
+		fn := s.handlers.banHandler
+		if e.Type == "UNBAN" {
+			fn = s.handlers.unbanHandler
+		}
+		if fn != nil {
+			fn(data, s)
+		}
+
+	case SubOnly:
+		if s.handlers.subOnlyHandler != nil {
+			s.handlers.subOnlyHandler(data, s)
+		}
+
+	case Broadcast:
+		if s.handlers.broadcastHandler != nil {
+			s.handlers.broadcastHandler(data, s)
+		}
+
+	case PrivateMessage:
+		if s.handlers.pmHandler != nil {
+			s.handlers.pmHandler(data, s)
+		}
+
+	case Ping:
+		if s.handlers.pingHandler != nil {
+			s.handlers.pingHandler(data, s)
+		}
+
+	case string:
+		if s.handlers.errHandler != nil {
+			s.handlers.errHandler(data, s)
+		}
+
+	case Names:
+		if s.handlers.namesHandler != nil {
+			s.handlers.namesHandler(data, s)
+		}
+
+	case RoomAction:
+		fn := s.handlers.joinHandler
+		if e.Type == "QUIT" {
+			fn = s.handlers.quitHandler
+		}
+		if fn != nil {
+			fn(data, s)
+		}
+
+	case User:
+		if s.handlers.userUpdateHandler != nil {
+			s.handlers.userUpdateHandler(data, s)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package dggchat
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// FetchHistory fetches the recent chat history from the http api, see *session.SetAPIURL().
+// The history is a list of protocol messages, mostly MSG, which are parsed like received
+// messages and returned oldest first with Historical set. Messages that could not be parsed
+// are returned with Err set. The chat room state is not changed.
+func (s *Session) FetchHistory(ctx context.Context) ([]Event, error) {
+	s.RLock()
+	req, err := s.newAPIRequest(ctx, http.MethodGet, "/api/chat/history", nil)
+	s.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var frames []string
+	if err := s.doAPIRequest(req, &frames); err != nil {
+		return nil, err
+	}
+
+	received := time.Now()
+	events := make([]Event, 0, len(frames))
+	for _, frame := range frames {
+		mType, mContent, ok := splitFrame([]byte(frame))
+		if !ok {
+			s.log().Warn("received malformed history frame", "frame", frame)
+			continue
+		}
+
+		e := Event{
+			Type:       mType,
+			Payload:    mContent,
+			Received:   received,
+			Historical: true,
+		}
+		e.Data, e.Err = parseEvent(mType, mContent, s)
+		if e.Err != nil {
+			s.log().Warn("could not parse history frame", "type", mType, "payload", mContent, "error", e.Err)
+			e.Data = nil
+		}
+		if m, ok := e.Data.(Message); ok {
+			m.Historical = true
+			e.Data = m
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// ReplayHistory fetches the recent chat history, see *session.FetchHistory(), and passes it
+// to the event listeners and handlers, e.g. to warm caches of bots on start.
+// Replayed events and messages have Historical set, they are never passed to the mention handler.
+func (s *Session) ReplayHistory(ctx context.Context) error {
+	events, err := s.FetchHistory(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		s.emit(e)
+		if e.Err == nil {
+			s.callHandler(e)
+		}
+	}
+	return nil
+}
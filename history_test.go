@@ -0,0 +1,67 @@
+package dggchat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestReplayHistory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat/history" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`[
+			"MSG {\"nick\":\"alice\",\"timestamp\":1,\"data\":\"hi destiny\"}",
+			"MSG {\"nick\":",
+			"garbage",
+			"BROADCAST {\"data\":\"live\",\"timestamp\":2}"
+		]`))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	s, _ := New()
+	s.SetAPIURL(*u)
+	s.state.setMe(User{Nick: "destiny"})
+
+	var messages []Message
+	var mentions, broadcasts int
+	s.AddMessageHandler(func(m Message, _ *Session) { messages = append(messages, m) })
+	s.AddMentionHandler(func(Message, *Session) { mentions++ })
+	s.AddBroadcastHandler(func(Broadcast, *Session) { broadcasts++ })
+
+	var events []Event
+	s.AddEventListener(func(e Event, _ *Session) { events = append(events, e) })
+
+	if err := s.ReplayHistory(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for _, e := range events {
+		if !e.Historical {
+			t.Errorf("expected event %s to be historical", e.Type)
+		}
+	}
+	if events[1].Err == nil {
+		t.Error("expected malformed message to be passed with an error")
+	}
+	if len(messages) != 1 || !messages[0].Historical || messages[0].Message != "hi destiny" {
+		t.Errorf("unexpected messages %+v", messages)
+	}
+	if mentions != 0 {
+		t.Errorf("expected historical messages not to be mentions, got %d", mentions)
+	}
+	if broadcasts != 1 {
+		t.Errorf("expected 1 broadcast, got %d", broadcasts)
+	}
+	if len(s.GetUsers()) != 0 {
+		t.Error("expected history not to change the chat room state")
+	}
+}
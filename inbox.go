@@ -0,0 +1,201 @@
+package dggchat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conversation is a private message conversation with another user in the inbox
+type Conversation struct {
+	User   User
+	Unread int
+	Read   int
+	// LastMessage is the text of the most recent message of the conversation
+	LastMessage string
+	Timestamp   time.Time
+}
+
+type conversation struct {
+	UserID    int64   `json:"userid"`
+	User      string  `json:"user"`
+	Unread    int     `json:"unread"`
+	Read      int     `json:"read"`
+	Message   string  `json:"message"`
+	Timestamp apiTime `json:"timestamp"`
+}
+
+type inboxMessage struct {
+	ID        int     `json:"id"`
+	UserID    int64   `json:"userid"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Message   string  `json:"message"`
+	Timestamp apiTime `json:"timestamp"`
+	IsRead    apiBool `json:"isread"`
+}
+
+type inboxMessageOut struct {
+	Message    string   `json:"message"`
+	Recipients []string `json:"recipients"`
+}
+
+// apiTime is a timestamp of the http api, sent either as milliseconds or as a date string
+type apiTime time.Time
+
+var apiTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05-0700", "2006-01-02 15:04:05"}
+
+func (t *apiTime) UnmarshalJSON(b []byte) error {
+	if ms, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+		*t = apiTime(unixToTime(ms))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	for _, layout := range apiTimeLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			*t = apiTime(parsed)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %s", b)
+}
+
+// apiBool is a flag of the http api, sent either as boolean or as 0 or 1
+type apiBool bool
+
+func (f *apiBool) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	*f = apiBool(s == "true" || s == "1")
+	return nil
+}
+
+// Conversations lists the private message conversations in the inbox, most recent first.
+// The session needs to be logged in, see *session.SetAPIURL() for the url used.
+func (s *Session) Conversations(ctx context.Context) ([]Conversation, error) {
+	var resp []conversation
+	if err := s.inboxRequest(ctx, http.MethodGet, "/api/messages/inbox", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	conversations := make([]Conversation, 0, len(resp))
+	for _, c := range resp {
+		conversations = append(conversations, Conversation{
+			User:        User{ID: c.UserID, Nick: c.User},
+			Unread:      c.Unread,
+			Read:        c.Read,
+			LastMessage: c.Message,
+			Timestamp:   time.Time(c.Timestamp),
+		})
+	}
+	return conversations, nil
+}
+
+// ConversationMessages returns the private messages received from the user with the given nick.
+// Messages we sent to the user are not included.
+func (s *Session) ConversationMessages(ctx context.Context, nick string) ([]PrivateMessage, error) {
+	messages, err := s.conversationMessages(ctx, nick)
+	if err != nil {
+		return nil, err
+	}
+
+	pms := make([]PrivateMessage, 0, len(messages))
+	for _, m := range messages {
+		if strings.EqualFold(m.From, nick) {
+			pms = append(pms, m.privateMessage())
+		}
+	}
+	return pms, nil
+}
+
+// UnreadPrivateMessages returns all unread private messages in the inbox, e.g. messages
+// received while offline. The messages are not marked as read.
+func (s *Session) UnreadPrivateMessages(ctx context.Context) ([]PrivateMessage, error) {
+	conversations, err := s.Conversations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pms []PrivateMessage
+	for _, c := range conversations {
+		if c.Unread == 0 {
+			continue
+		}
+		messages, err := s.conversationMessages(ctx, c.User.Nick)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range messages {
+			if !bool(m.IsRead) && strings.EqualFold(m.From, c.User.Nick) {
+				pms = append(pms, m.privateMessage())
+			}
+		}
+	}
+	return pms, nil
+}
+
+// MarkPrivateMessageRead marks the private message with the given id as read
+func (s *Session) MarkPrivateMessageRead(ctx context.Context, id int) error {
+	return s.inboxRequest(ctx, http.MethodPost, fmt.Sprintf("/api/messages/msg/%d/open", id), nil, nil)
+}
+
+// SendPrivateMessageHTTP sends the given user a private message through the http api,
+// which works without an open connection to chat.
+func (s *Session) SendPrivateMessageHTTP(ctx context.Context, nick string, message string) error {
+	body, err := json.Marshal(inboxMessageOut{Message: message, Recipients: []string{nick}})
+	if err != nil {
+		return err
+	}
+	return s.inboxRequest(ctx, http.MethodPost, "/api/messages/send", body, nil)
+}
+
+func (s *Session) conversationMessages(ctx context.Context, nick string) ([]inboxMessage, error) {
+	var messages []inboxMessage
+	path := fmt.Sprintf("/api/messages/usr/%s/inbox", url.PathEscape(nick))
+	if err := s.inboxRequest(ctx, http.MethodGet, path, nil, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// inboxRequest makes a request to the messages api, which is only available to logged in sessions
+func (s *Session) inboxRequest(ctx context.Context, method string, path string, body []byte, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	s.RLock()
+	if s.readOnly {
+		s.RUnlock()
+		return ErrReadOnly
+	}
+	req, err := s.newAPIRequest(ctx, method, path, r)
+	s.RUnlock()
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return s.doAPIRequest(req, v)
+}
+
+func (m inboxMessage) privateMessage() PrivateMessage {
+	return PrivateMessage{
+		User:      User{ID: m.UserID, Nick: m.From},
+		Message:   m.Message,
+		Timestamp: time.Time(m.Timestamp),
+		ID:        m.ID,
+	}
+}
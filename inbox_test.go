@@ -0,0 +1,99 @@
+package dggchat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestInbox(t *testing.T) {
+	var sent inboxMessageOut
+	var opened []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/messages/inbox", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "authtoken=key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`[
+			{"userid":1,"user":"alice","unread":1,"read":1,"message":"are you there?","timestamp":"2023-11-14T22:13:20+0000"},
+			{"userid":2,"user":"bob","unread":0,"read":3,"message":"ok","timestamp":1700000000000}
+		]`))
+	})
+	mux.HandleFunc("/api/messages/usr/alice/inbox", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[
+			{"id":10,"userid":1,"from":"alice","to":"me","message":"hi","timestamp":1700000000000,"isread":1},
+			{"id":11,"userid":3,"from":"me","to":"alice","message":"hello","timestamp":1700000001000,"isread":0},
+			{"id":12,"userid":1,"from":"alice","to":"me","message":"are you there?","timestamp":1700000002000,"isread":false}
+		]`))
+	})
+	mux.HandleFunc("/api/messages/msg/12/open", func(w http.ResponseWriter, r *http.Request) {
+		opened = append(opened, r.Method)
+	})
+	mux.HandleFunc("/api/messages/send", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	s, _ := New("key")
+	s.SetAPIURL(*u)
+	ctx := context.Background()
+
+	conversations, err := s.Conversations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 2 || conversations[0].User.Nick != "alice" || conversations[0].Unread != 1 {
+		t.Errorf("unexpected conversations %+v", conversations)
+	}
+	want := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	if !conversations[0].Timestamp.Equal(want) || !conversations[1].Timestamp.Equal(want) {
+		t.Errorf("unexpected timestamps %v, %v", conversations[0].Timestamp, conversations[1].Timestamp)
+	}
+
+	unread, err := s.UnreadPrivateMessages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unread) != 1 || unread[0].ID != 12 || unread[0].User.Nick != "alice" || unread[0].Message != "are you there?" {
+		t.Fatalf("unexpected unread messages %+v", unread)
+	}
+
+	if err := s.MarkPrivateMessageRead(ctx, unread[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(opened) != 1 || opened[0] != http.MethodPost {
+		t.Errorf("expected message to be opened with a POST, got %v", opened)
+	}
+
+	if err := s.SendPrivateMessageHTTP(ctx, "alice", "back now"); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Message != "back now" || len(sent.Recipients) != 1 || sent.Recipients[0] != "alice" {
+		t.Errorf("unexpected sent message %+v", sent)
+	}
+
+	var escaped string
+	mux.HandleFunc("/api/messages/usr/", func(w http.ResponseWriter, r *http.Request) {
+		escaped = r.URL.EscapedPath()
+		_, _ = w.Write([]byte(`[]`))
+	})
+	if _, err := s.ConversationMessages(ctx, "a/b c?"); err != nil {
+		t.Fatal(err)
+	}
+	if escaped != "/api/messages/usr/a%2Fb%20c%3F/inbox" {
+		t.Errorf("expected nick to be escaped, got %s", escaped)
+	}
+
+	readOnly, _ := New()
+	if _, err := readOnly.Conversations(ctx); err != ErrReadOnly {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+}
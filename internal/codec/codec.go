@@ -0,0 +1,20 @@
+// Package codec lets the protocol package use the protocol implementation of package dggchat,
+// which is not exported there, as it relies on the unexported wire structures.
+package codec
+
+import "errors"
+
+// ErrMalformedFrame is thrown when decoding a protocol message without type or content
+var ErrMalformedFrame = errors.New("malformed protocol message")
+
+// ErrUnknownEvent is thrown when encoding an event whose type can not be determined
+var ErrUnknownEvent = errors.New("unknown event type")
+
+// Encode and Decode are set by package dggchat when it is initialized.
+// The events passed and returned are dggchat.Event values.
+// They are nil until then, and calling them panics, so packages using them must import
+// package dggchat, which makes sure it is initialized first.
+var (
+	Encode func(e interface{}) ([]byte, error)
+	Decode func(frame []byte) (interface{}, error)
+)
@@ -0,0 +1,45 @@
+package dggchat
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// redacted replaces sensitive values in logs
+const redacted = "REDACTED"
+
+// SetLogger sets the logger the session reports its activity to, nil disables logging.
+// Received and sent frames are logged at debug level, connection changes at info level,
+// and malformed frames or failed reconnects at warn level. Login keys are never logged.
+func (s *Session) SetLogger(l *slog.Logger) {
+	s.logger.Store(l)
+}
+
+// log returns the logger of the session, or a logger discarding everything
+func (s *Session) log() *slog.Logger {
+	if l := s.logger.Load(); l != nil {
+		return l
+	}
+	return discardLogger
+}
+
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// redactHeader returns a copy of the header that is safe to log
+func redactHeader(h http.Header) http.Header {
+	c := h.Clone()
+	for _, k := range []string{"Cookie", "Authorization"} {
+		if _, ok := c[k]; ok {
+			c.Set(k, redacted)
+		}
+	}
+	return c
+}
@@ -0,0 +1,203 @@
+// Package logging writes human readable daily chat logs in the format
+// used by the destiny.gg and OverRustle log archives:
+//
+//	[2006-01-02 15:04:05 UTC] nick: message
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+const (
+	timeFormat  = "2006-01-02 15:04:05 MST"
+	fileFormat  = "2006-01-02"
+	monthFormat = "January 2006"
+)
+
+// ErrClosed is returned when writing to a closed Writer
+var ErrClosed = errors.New("log writer is closed")
+
+// A Writer writes chat events to one log file per UTC day, grouped into a directory per month,
+// e.g. "<dir>/January 2006/2006-01-02.txt". It is safe for concurrent use.
+type Writer struct {
+	sync.Mutex
+	dir    string
+	file   *os.File
+	day    string
+	remove []func()
+	closed bool
+}
+
+// New creates a writer that stores logs in the given directory
+func New(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Writer{dir: dir}, nil
+}
+
+// Attach starts logging all events received by the session.
+// Events replayed from the chat history are not logged.
+func (w *Writer) Attach(s *dggchat.Session) {
+	remove := s.AddEventListener(func(e dggchat.Event, _ *dggchat.Session) {
+		if e.Historical {
+			return
+		}
+		_ = w.WriteEvent(e)
+	})
+
+	w.Lock()
+	defer w.Unlock()
+	w.remove = append(w.remove, remove)
+}
+
+// Close stops logging and closes the current log file.
+// Writing afterwards returns ErrClosed.
+func (w *Writer) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	w.closed = true
+	for _, remove := range w.remove {
+		remove()
+	}
+	w.remove = nil
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// WriteEvent writes a single event to the log of the day it happened on.
+// Events that are not logged, like joins, are ignored.
+func (w *Writer) WriteEvent(e dggchat.Event) error {
+	t, line, ok := Format(e)
+	if !ok {
+		return nil
+	}
+	return w.WriteLine(t, line)
+}
+
+// WriteLine writes the line with the given time prefixed to the log of that day
+func (w *Writer) WriteLine(t time.Time, line string) error {
+	t = t.UTC()
+
+	w.Lock()
+	defer w.Unlock()
+
+	// a listener may still be writing while closing, which must not reopen the file
+	if w.closed {
+		return ErrClosed
+	}
+	if err := w.rotate(t); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w.file, "[%s] %s\n", t.Format(timeFormat), line)
+	return err
+}
+
+// rotate makes sure the file for the day of t is open.
+// call with locks held
+func (w *Writer) rotate(t time.Time) error {
+	day := t.Format(fileFormat)
+	if w.file != nil && w.day == day {
+		return nil
+	}
+
+	dir := filepath.Join(w.dir, t.Format(monthFormat))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, day+".txt"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if w.file != nil {
+		_ = w.file.Close()
+	}
+	w.file = f
+	w.day = day
+	return nil
+}
+
+// Format returns the time and text of the log line for an event.
+// If the event is not logged, false is returned as the third parameter.
+func Format(e dggchat.Event) (time.Time, string, bool) {
+	switch d := e.Data.(type) {
+	case dggchat.Message:
+		return d.Timestamp, fmt.Sprintf("%s: %s", d.Sender.Nick, d.Message), true
+
+	case dggchat.Broadcast:
+		return orNow(d.Timestamp), fmt.Sprintf("Broadcast: %s", d.Message), true
+
+	case dggchat.Mute:
+		if e.Type == "UNMUTE" {
+			return d.Timestamp, fmt.Sprintf("%s unmuted by %s", d.Target.Nick, d.Sender.Nick), true
+		}
+		return d.Timestamp, fmt.Sprintf("%s muted by %s", d.Target.Nick, d.Sender.Nick), true
+
+	case dggchat.Ban:
+		if e.Type == "UNBAN" {
+			return d.Timestamp, fmt.Sprintf("%s unbanned by %s", d.Target.Nick, d.Sender.Nick), true
+		}
+		return d.Timestamp, fmt.Sprintf("%s banned by %s", d.Target.Nick, d.Sender.Nick), true
+
+	case dggchat.Subscription:
+		return d.Timestamp, formatSubscription(d), true
+
+	case dggchat.Donation:
+		line := fmt.Sprintf("Donation: %s donated $%d.%02d", d.Sender.Nick, d.Amount/100, d.Amount%100)
+		if d.Message != "" {
+			line += ": " + d.Message
+		}
+		return d.Timestamp, line, true
+
+	case dggchat.SubOnly:
+		mode := "off"
+		if d.Active {
+			mode = "on"
+		}
+		return d.Timestamp, fmt.Sprintf("Subscriber only mode turned %s by %s", mode, d.Sender.Nick), true
+	}
+
+	return time.Time{}, "", false
+}
+
+func formatSubscription(s dggchat.Subscription) string {
+	tier := s.Tier.Label
+	if tier == "" {
+		tier = fmt.Sprintf("Tier %d", s.Tier.Tier)
+	}
+
+	var line string
+	switch {
+	case s.IsMassGift():
+		line = fmt.Sprintf("Subscriber: %s gifted %d %s subscriptions", s.Sender.Nick, s.Quantity, tier)
+	case s.IsGift():
+		line = fmt.Sprintf("Subscriber: %s gifted %s a %s subscription", s.Sender.Nick, s.Recipient.Nick, tier)
+	default:
+		line = fmt.Sprintf("Subscriber: %s subscribed with %s", s.Sender.Nick, tier)
+	}
+	if s.Message != "" {
+		line += ": " + s.Message
+	}
+	return line
+}
+
+func orNow(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestFormat(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mod := dggchat.User{Nick: "mod"}
+	alice := dggchat.User{Nick: "alice"}
+	bob := dggchat.User{Nick: "bob"}
+
+	tests := []struct {
+		name  string
+		event dggchat.Event
+		want  string
+	}{
+		{"message", dggchat.Event{Data: dggchat.Message{Sender: alice, Timestamp: ts, Message: "hi"}}, "alice: hi"},
+		{"action", dggchat.Event{Data: dggchat.Message{Sender: alice, Timestamp: ts, Message: "/me waves"}}, "alice: /me waves"},
+		{"broadcast", dggchat.Event{Data: dggchat.Broadcast{Timestamp: ts, Message: "live"}}, "Broadcast: live"},
+		{"mute", dggchat.Event{Type: "MUTE", Data: dggchat.Mute{Sender: mod, Target: alice, Timestamp: ts}}, "alice muted by mod"},
+		{"unmute", dggchat.Event{Type: "UNMUTE", Data: dggchat.Mute{Sender: mod, Target: alice, Timestamp: ts}}, "alice unmuted by mod"},
+		{"ban", dggchat.Event{Type: "BAN", Data: dggchat.Ban{Sender: mod, Target: alice, Timestamp: ts}}, "alice banned by mod"},
+		{"unban", dggchat.Event{Type: "UNBAN", Data: dggchat.Ban{Sender: mod, Target: alice, Timestamp: ts}}, "alice unbanned by mod"},
+		{"subscription", dggchat.Event{Data: dggchat.Subscription{
+			Sender: alice, Recipient: alice, Timestamp: ts, Tier: dggchat.SubTier{Tier: 2},
+		}}, "Subscriber: alice subscribed with Tier 2"},
+		{"subscription with message", dggchat.Event{Data: dggchat.Subscription{
+			Sender: alice, Recipient: alice, Timestamp: ts, Tier: dggchat.SubTier{Tier: 1, Label: "Tier I"}, Message: "hype",
+		}}, "Subscriber: alice subscribed with Tier I: hype"},
+		{"gift", dggchat.Event{Data: dggchat.Subscription{
+			Sender: alice, Recipient: bob, Timestamp: ts, Tier: dggchat.SubTier{Tier: 3},
+		}}, "Subscriber: alice gifted bob a Tier 3 subscription"},
+		{"mass gift", dggchat.Event{Data: dggchat.Subscription{
+			Sender: alice, Timestamp: ts, Tier: dggchat.SubTier{Tier: 1}, Quantity: 5,
+		}}, "Subscriber: alice gifted 5 Tier 1 subscriptions"},
+		{"donation", dggchat.Event{Data: dggchat.Donation{Sender: alice, Timestamp: ts, Amount: 505}}, "Donation: alice donated $5.05"},
+		{"donation with message", dggchat.Event{Data: dggchat.Donation{Sender: alice, Timestamp: ts, Amount: 1000, Message: "hi"}}, "Donation: alice donated $10.00: hi"},
+		{"sub only on", dggchat.Event{Data: dggchat.SubOnly{Sender: mod, Timestamp: ts, Active: true}}, "Subscriber only mode turned on by mod"},
+		{"sub only off", dggchat.Event{Data: dggchat.SubOnly{Sender: mod, Timestamp: ts}}, "Subscriber only mode turned off by mod"},
+	}
+	for _, tt := range tests {
+		got, line, ok := Format(tt.event)
+		if !ok || line != tt.want {
+			t.Errorf("%s: expected %q, got %q (%v)", tt.name, tt.want, line, ok)
+		}
+		if !got.Equal(ts) {
+			t.Errorf("%s: expected time %v, got %v", tt.name, ts, got)
+		}
+	}
+
+	for _, e := range []dggchat.Event{
+		{Type: "JOIN", Data: dggchat.RoomAction{User: alice, Timestamp: ts}},
+		{Type: "NAMES", Data: dggchat.Names{}},
+		{Type: "ERR", Data: "throttled"},
+	} {
+		if _, line, ok := Format(e); ok {
+			t.Errorf("expected %s not to be logged, got %q", e.Type, line)
+		}
+	}
+
+	if got, _, _ := Format(dggchat.Event{Data: dggchat.Broadcast{Message: "live"}}); got.IsZero() {
+		t.Error("expected broadcasts without timestamp to use the current time")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	dir := t.TempDir()
+	w, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day1 := time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)
+	day2 := time.Date(2024, 2, 1, 0, 0, 1, 0, time.FixedZone("CET", 3600))
+	for _, line := range []struct {
+		t    time.Time
+		text string
+	}{
+		{day1, "alice: hi"},
+		{day1, "bob: hello"},
+		// still the 31st in UTC
+		{day2, "alice: bye"},
+		{day2.Add(time.Hour), "bob: morning"},
+	} {
+		if err := w.WriteLine(line.t, line.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		filepath.Join("January 2024", "2024-01-31.txt"): "[2024-01-31 23:59:59 UTC] alice: hi\n" +
+			"[2024-01-31 23:59:59 UTC] bob: hello\n" +
+			"[2024-01-31 23:00:01 UTC] alice: bye\n",
+		filepath.Join("February 2024", "2024-02-01.txt"): "[2024-02-01 00:00:01 UTC] bob: morning\n",
+	}
+	for name, want := range files {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", name, want, b)
+		}
+	}
+
+	if err := w.WriteLine(day1, "late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "January 2024", "2024-01-31.txt"))
+	if string(b) != files[filepath.Join("January 2024", "2024-01-31.txt")] {
+		t.Error("expected nothing to be written after closing")
+	}
+}
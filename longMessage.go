@@ -0,0 +1,103 @@
+package dggchat
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxMessageLength is the maximum amount of characters the server accepts in a single message.
+// Longer messages are rejected with ErrorInvalidMessage.
+const MaxMessageLength = 512
+
+// longMessageInterval is the minimum time between the parts of a long message,
+// sending faster makes the server reply with ErrorThorttled.
+const longMessageInterval = 300 * time.Millisecond
+
+// repeatMarker is appended to a message that is equal to the previous one,
+// so the server does not reject it with ErrorDuplicate.
+const repeatMarker = " \u200b"
+
+// SendLongMessage sends the given string to chat, split into multiple messages
+// if it is longer than MaxMessageLength. Messages are split between words, so
+// emotes and links are kept intact unless a single word exceeds the limit.
+// Repeated parts are made unique, and the duplicate policy applies as with SendMessage.
+// The parts are sent no faster than the send interval, or 300ms if it is shorter.
+// same caveat with the returned error value as SendMessage applies.
+func (s *Session) SendLongMessage(message string) error {
+	for _, part := range splitMessage(message, MaxMessageLength) {
+		if err := s.sendChatMessage(part, longMessageInterval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendLongPrivateMessage sends the given user a private message,
+// split into multiple messages in the same way as SendLongMessage.
+func (s *Session) SendLongPrivateMessage(nick string, message string) error {
+	for _, part := range splitMessage(message, MaxMessageLength) {
+		p := privateMessageOut{
+			Nick: nick,
+			Data: part,
+		}
+		if err := s.sendWithInterval(p, "PRIVMSG", longMessageInterval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitMessage splits message into parts of at most limit characters, breaking
+// only on whitespace unless a single word is longer than limit.
+// Consecutive equal parts are made unique with repeatMarker.
+func splitMessage(message string, limit int) []string {
+	// leave room to mark repeated parts
+	limit -= utf8.RuneCountInString(repeatMarker)
+
+	var (
+		parts   []string
+		current []string
+		length  int
+	)
+	flush := func() {
+		if len(current) > 0 {
+			parts = append(parts, strings.Join(current, " "))
+			current = current[:0]
+			length = 0
+		}
+	}
+
+	for _, word := range strings.Fields(message) {
+		wordLength := utf8.RuneCountInString(word)
+
+		if wordLength > limit {
+			flush()
+			runes := []rune(word)
+			for len(runes) > limit {
+				parts = append(parts, string(runes[:limit]))
+				runes = runes[limit:]
+			}
+			word = string(runes)
+			wordLength = len(runes)
+		}
+
+		if length > 0 && length+1+wordLength > limit {
+			flush()
+		}
+		if length > 0 {
+			length++
+		}
+		current = append(current, word)
+		length += wordLength
+	}
+	flush()
+
+	for i := 1; i < len(parts); i++ {
+		if strings.EqualFold(parts[i], parts[i-1]) {
+			parts[i] += repeatMarker
+		}
+	}
+
+	return parts
+}
@@ -0,0 +1,67 @@
+package dggchat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		limit   int
+		want    []string
+	}{
+		{"empty", "", 12, nil},
+		{"whitespace", "  \t ", 12, nil},
+		{"short", "hello world", 13, []string{"hello world"}},
+		{"collapses whitespace", " hello   world ", 13, []string{"hello world"}},
+		{"breaks between words", "hello there world", 13, []string{"hello there", "world"}},
+		// room for the repeat marker is always left
+		{"exactly fits", "abcd efgh", 11, []string{"abcd efgh"}},
+		{"one over", "abcd efghi", 11, []string{"abcd", "efghi"}},
+		{"long word", "abcdefghijklmnopqrstuvwxyz", 12, []string{"abcdefghij", "klmnopqrst", "uvwxyz"}},
+		{"long word between words", "hi abcdefghijklmnop yo", 12, []string{"hi", "abcdefghij", "klmnop yo"}},
+		{"counts runes", "ääää öööö üüüü", 11, []string{"ääää öööö", "üüüü"}},
+		{"marks repeated parts", "PepeLaugh PepeLaugh", 11, []string{"PepeLaugh", "PepeLaugh" + repeatMarker}},
+		{"marks repeats ignoring case", "abc ABC", 5, []string{"abc", "ABC" + repeatMarker}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.message, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitMessage(%q, %d) = %q, want %q", tt.message, tt.limit, got, tt.want)
+			}
+			for _, part := range got {
+				if n := len([]rune(part)); n > tt.limit {
+					t.Errorf("part %q has %d characters, more than the limit", part, n)
+				}
+			}
+		})
+	}
+
+	parts := splitMessage(strings.Repeat("word ", 300), MaxMessageLength)
+	if len(parts) != 3 {
+		t.Errorf("expected 3 parts, got %d", len(parts))
+	}
+}
+
+func TestReserveSend(t *testing.T) {
+	s, _ := New("key")
+	s.SetSendInterval(100 * time.Millisecond)
+
+	s.Lock()
+	defer s.Unlock()
+	waits := []time.Duration{s.reserveSend(0), s.reserveSend(0), s.reserveSend(300 * time.Millisecond)}
+	if waits[0] != 0 {
+		t.Errorf("expected first message not to wait, got %v", waits[0])
+	}
+	if waits[1] <= 90*time.Millisecond || waits[1] > 100*time.Millisecond {
+		t.Errorf("expected second message to wait the send interval, got %v", waits[1])
+	}
+	if waits[2] <= 390*time.Millisecond || waits[2] > 400*time.Millisecond {
+		t.Errorf("expected third message to wait for the second and the longer interval, got %v", waits[2])
+	}
+}
@@ -1,6 +1,7 @@
 package dggchat
 
 import (
+	"regexp"
 	"strings"
 	"time"
 )
@@ -42,6 +43,8 @@ const (
 	ErrorDuplicate          = "duplicate"
 	ErrorNotFound           = "notfound"
 	ErrorNeedBanReason      = "needbanreason"
+	ErrorBanned             = "banned"
+	ErrorProtected          = "protectederror"
 )
 
 type (
@@ -50,6 +53,8 @@ type (
 		Sender    User
 		Timestamp time.Time
 		Message   string
+		// Historical is set for messages replayed from the chat history, see *session.ReplayHistory()
+		Historical bool `json:"-"`
 	}
 
 	message struct {
@@ -58,6 +63,12 @@ type (
 		Data      string `json:"data"`
 	}
 
+	mute struct {
+		message
+		// Duration is sent in seconds
+		Duration int64 `json:"duration,omitempty"`
+	}
+
 	// Pin represents a pinned dgg message, AKA message of the day (MOTD)
 	Pin struct {
 		Sender    User
@@ -80,6 +91,8 @@ type (
 		Target    User
 		// Online indicates whether the target was online when targeted
 		Online bool
+		// Duration is the length of the mute if sent by the server, otherwise 0
+		Duration time.Duration
 	}
 
 	// Ban represents (un)bans issued by chat moderators
@@ -145,6 +158,19 @@ type (
 		UUID      string `json:"uuid"`
 	}
 
+	broadcast struct {
+		User
+		Data      string `json:"data"`
+		UUID      string `json:"uuid"`
+		Timestamp int64  `json:"timestamp"`
+	}
+
+	errorMessage struct {
+		Description string `json:"description"`
+		// MuteTimeLeft is the remaining mute duration in seconds, sent with ErrorMuted
+		MuteTimeLeft int64 `json:"muteTimeLeft,omitempty"`
+	}
+
 	// SubTier represents a dgg subscription tier
 	SubTier struct {
 		Tier  int64
@@ -230,6 +256,23 @@ func (m *Message) IsAction() bool {
 	return strings.HasPrefix(m.Message, "/me ")
 }
 
+// Mentions returns true if the message contains the given nick (or any other word)
+// as a whole word, ignoring case. This matches how chat highlights messages.
+func (m *Message) Mentions(nick string) bool {
+	re := mentionPattern(nick)
+	return re != nil && re.MatchString(m.Message)
+}
+
+// mentionPattern compiles the expression matching the word as a whole word, ignoring case.
+// Returns nil for empty words.
+func mentionPattern(word string) *regexp.Regexp {
+	word = strings.TrimSpace(word)
+	if word == "" {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)(^|\W)` + regexp.QuoteMeta(word) + `($|\W)`)
+}
+
 // IsGift returns true if the subscription was a gift
 func (s *Subscription) IsGift() bool {
 	return s.Sender.Nick != s.Recipient.Nick
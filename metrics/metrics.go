@@ -0,0 +1,373 @@
+// Package metrics collects metrics about chat sessions and serves them in the
+// Prometheus text exposition format.
+//
+//	c := metrics.New()
+//	c.Attach("bot", session)
+//	http.Handle("/metrics", c)
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histograms
+var DefaultBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+	counter   metricType = "counter"
+	gauge     metricType = "gauge"
+	histogram metricType = "histogram"
+)
+
+// descriptions of all exposed metrics, in the order they are written
+var descs = []struct {
+	name string
+	typ  metricType
+	help string
+}{
+	{"dggchat_frames_received_total", counter, "Messages received from the chat server by type."},
+	{"dggchat_parse_errors_total", counter, "Received messages that could not be parsed by type."},
+	{"dggchat_sends_total", counter, "Messages written to the chat server by type."},
+	{"dggchat_send_errors_total", counter, "Messages that could not be written to the chat server by type."},
+	{"dggchat_server_errors_total", counter, "Error messages received from the chat server by error code."},
+	{"dggchat_reconnect_attempts_total", counter, "Attempts to reconnect to the chat server."},
+	{"dggchat_reconnect_failures_total", counter, "Failed attempts to reconnect to the chat server."},
+	{"dggchat_users", gauge, "Users currently in chat."},
+	{"dggchat_connections", gauge, "Connections to chat as last reported by the server."},
+	{"dggchat_handler_duration_seconds", histogram, "Time taken by the handler of a received message by type."},
+	{"dggchat_ping_rtt_seconds", histogram, "Round trip time of pings sent to the chat server."},
+}
+
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Collector collects metrics of one or more sessions, distinguished by the session label.
+// It implements http.Handler serving the metrics. It is safe for concurrent use.
+type Collector struct {
+	sync.Mutex
+	buckets    []float64
+	values     map[string]map[string]float64
+	histograms map[string]map[string]*histogramValue
+	sessions   map[string]*dggchat.Session
+	remove     map[string]func()
+}
+
+// New creates an empty collector
+func New() *Collector {
+	return &Collector{
+		buckets:    DefaultBuckets,
+		values:     make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogramValue),
+		sessions:   make(map[string]*dggchat.Session),
+		remove:     make(map[string]func()),
+	}
+}
+
+// Attach starts collecting metrics of the session, labeled with the given name.
+// A session attached before with the same name is detached.
+// This replaces the observer of the session, see *session.SetObserver().
+// Events replayed from the chat history are not counted.
+func (c *Collector) Attach(name string, s *dggchat.Session) {
+	c.Lock()
+	defer c.Unlock()
+	// detach first, re-attaching the same session would otherwise remove the new observer
+	if previous, ok := c.remove[name]; ok {
+		previous()
+	}
+
+	o := &observer{collector: c, session: name}
+	s.SetObserver(o)
+	remove := s.AddEventListener(func(e dggchat.Event, _ *dggchat.Session) {
+		if e.Historical {
+			return
+		}
+		c.observeEvent(name, e)
+	})
+	c.sessions[name] = s
+	c.remove[name] = func() {
+		remove()
+		// the observer may have been replaced since, e.g. by another collector
+		if s.Observer() == dggchat.Observer(o) {
+			s.SetObserver(nil)
+		}
+	}
+}
+
+// Detach stops collecting metrics of the session with the given name.
+// Its collected counters are still served.
+func (c *Collector) Detach(name string) {
+	c.Lock()
+	defer c.Unlock()
+	if remove, ok := c.remove[name]; ok {
+		remove()
+		delete(c.remove, name)
+	}
+	delete(c.sessions, name)
+}
+
+// Close stops collecting metrics of all attached sessions. Collected metrics are still served.
+func (c *Collector) Close() {
+	c.Lock()
+	defer c.Unlock()
+	for name, remove := range c.remove {
+		remove()
+		delete(c.remove, name)
+		delete(c.sessions, name)
+	}
+}
+
+func (c *Collector) observeEvent(session string, e dggchat.Event) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.add("dggchat_frames_received_total", labels("session", session, "type", e.Type), 1)
+	if e.Err != nil {
+		c.add("dggchat_parse_errors_total", labels("session", session, "type", e.Type), 1)
+		return
+	}
+
+	switch data := e.Data.(type) {
+	case string:
+		if e.Type == "ERR" {
+			c.add("dggchat_server_errors_total", labels("session", session, "code", errorCode(data)), 1)
+		}
+	case dggchat.Names:
+		c.set("dggchat_connections", labels("session", session), float64(data.Connections))
+	case dggchat.Ping:
+		if data.Timestamp > 0 && !e.Received.IsZero() {
+			rtt := e.Received.Sub(time.UnixMilli(data.Timestamp))
+			c.observe("dggchat_ping_rtt_seconds", labels("session", session), rtt)
+		}
+	}
+}
+
+// knownErrors are the error codes used as label, others are counted as "other",
+// so servers can not create an unbounded number of series
+var knownErrors = map[string]bool{
+	dggchat.ErrorTooManyConnections: true,
+	dggchat.ErrorProtocol:           true,
+	dggchat.ErrorNeedLogin:          true,
+	dggchat.ErrorNoPermission:       true,
+	dggchat.ErrorInvalidMessage:     true,
+	dggchat.ErrorMuted:              true,
+	dggchat.ErrorSubMode:            true,
+	dggchat.ErrorThorttled:          true,
+	dggchat.ErrorDuplicate:          true,
+	dggchat.ErrorNotFound:           true,
+	dggchat.ErrorNeedBanReason:      true,
+	dggchat.ErrorBanned:             true,
+	dggchat.ErrorProtected:          true,
+}
+
+func errorCode(description string) string {
+	if knownErrors[description] {
+		return description
+	}
+	return "other"
+}
+
+// call with locks held
+func (c *Collector) add(name string, labels string, v float64) {
+	if c.values[name] == nil {
+		c.values[name] = make(map[string]float64)
+	}
+	c.values[name][labels] += v
+}
+
+// call with locks held
+func (c *Collector) set(name string, labels string, v float64) {
+	if c.values[name] == nil {
+		c.values[name] = make(map[string]float64)
+	}
+	c.values[name][labels] = v
+}
+
+// call with locks held
+func (c *Collector) observe(name string, labels string, d time.Duration) {
+	if c.histograms[name] == nil {
+		c.histograms[name] = make(map[string]*histogramValue)
+	}
+	h, ok := c.histograms[name][labels]
+	if !ok {
+		h = &histogramValue{counts: make([]uint64, len(c.buckets))}
+		c.histograms[name][labels] = h
+	}
+
+	v := d.Seconds()
+	for i, le := range c.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	// users are read at scrape time, the sessions are not locked while holding the collector lock
+	c.Lock()
+	sessions := make(map[string]*dggchat.Session, len(c.sessions))
+	for name, s := range c.sessions {
+		sessions[name] = s
+	}
+	c.Unlock()
+	users := make(map[string]float64, len(sessions))
+	for name, s := range sessions {
+		users[labels("session", name)] = float64(len(s.GetUsers()))
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, d := range descs {
+		values := c.values[d.name]
+		if d.name == "dggchat_users" {
+			values = users
+		}
+		if len(values) == 0 && len(c.histograms[d.name]) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.typ)
+		for _, l := range sortedKeys(values) {
+			fmt.Fprintf(cw, "%s%s %s\n", d.name, l, formatFloat(values[l]))
+		}
+
+		hs := c.histograms[d.name]
+		keys := make([]string, 0, len(hs))
+		for l := range hs {
+			keys = append(keys, l)
+		}
+		sort.Strings(keys)
+		for _, l := range keys {
+			c.writeHistogram(cw, d.name, l, hs[l])
+		}
+	}
+
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, cw.err
+}
+
+// call with locks held
+func (c *Collector) writeHistogram(w io.Writer, name string, l string, h *histogramValue) {
+	for i, le := range c.buckets {
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(l, "le", formatFloat(le)), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(l, "le", "+Inf"), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, l, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, l, h.count)
+}
+
+// observer receives the activity of a session that is not visible through events
+type observer struct {
+	collector *Collector
+	session   string
+}
+
+func (o *observer) ObserveSend(mType string, err error) {
+	o.collector.Lock()
+	defer o.collector.Unlock()
+	o.collector.add("dggchat_sends_total", labels("session", o.session, "type", mType), 1)
+	if err != nil {
+		o.collector.add("dggchat_send_errors_total", labels("session", o.session, "type", mType), 1)
+	}
+}
+
+func (o *observer) ObserveReconnect(err error) {
+	o.collector.Lock()
+	defer o.collector.Unlock()
+	o.collector.add("dggchat_reconnect_attempts_total", labels("session", o.session), 1)
+	if err != nil {
+		o.collector.add("dggchat_reconnect_failures_total", labels("session", o.session), 1)
+	}
+}
+
+func (o *observer) ObserveHandler(mType string, d time.Duration) {
+	o.collector.Lock()
+	defer o.collector.Unlock()
+	o.collector.observe("dggchat_handler_duration_seconds", labels("session", o.session, "type", mType), d)
+}
+
+// labels formats pairs of label names and values, e.g. {session="bot",type="MSG"}
+func labels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withLabel adds a label to formatted labels
+func withLabel(l string, name string, value string) string {
+	extra := labels(name, value)
+	if l == "{}" || l == "" {
+		return extra
+	}
+	return l[:len(l)-1] + "," + extra[1:]
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/MemeLabs/dggchat/dggchattest"
+)
+
+func TestCollectorEvents(t *testing.T) {
+	s, _ := dggchat.New()
+	s.AddMessageHandler(func(dggchat.Message, *dggchat.Session) {})
+	c := New()
+	c.Attach("bot", s)
+	defer c.Close()
+
+	now := time.Now()
+	s.Dispatch([]byte(`NAMES {"connectioncount":5,"users":[{"nick":"alice"},{"nick":"bob"}]}`), now)
+	s.Dispatch([]byte(`MSG {"nick":"alice","data":"hi","timestamp":1}`), now)
+	s.Dispatch([]byte(`MSG {"nick":"alice","data":"hi","timestamp":1}`), now)
+	s.Dispatch([]byte(`MSG {"nick":`), now)
+	s.Dispatch([]byte(`ERR "throttled"`), now)
+	s.Dispatch([]byte(`ERR "made up"`), now)
+	s.Dispatch([]byte(fmt.Sprintf(`PONG {"timestamp":%d}`, now.Add(-20*time.Millisecond).UnixMilli())), now)
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE dggchat_frames_received_total counter\n",
+		`dggchat_frames_received_total{session="bot",type="MSG"} 3` + "\n",
+		`dggchat_parse_errors_total{session="bot",type="MSG"} 1` + "\n",
+		`dggchat_server_errors_total{session="bot",code="throttled"} 1` + "\n",
+		`dggchat_server_errors_total{session="bot",code="other"} 1` + "\n",
+		`dggchat_users{session="bot"} 2` + "\n",
+		`dggchat_connections{session="bot"} 5` + "\n",
+		`dggchat_handler_duration_seconds_count{session="bot",type="MSG"} 2` + "\n",
+		`dggchat_handler_duration_seconds_bucket{session="bot",type="MSG",le="+Inf"} 2` + "\n",
+		`dggchat_ping_rtt_seconds_bucket{session="bot",le="0.025"} 1` + "\n",
+		`dggchat_ping_rtt_seconds_bucket{session="bot",le="0.01"} 0` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+}
+
+func TestCollectorSends(t *testing.T) {
+	srv := dggchattest.NewServer()
+	defer srv.Close()
+	srv.SetMe(dggchat.User{Nick: "bot"})
+
+	s, _ := dggchat.New("key")
+	s.SetURL(srv.URL())
+	s.SetAPIURL(srv.APIURL())
+	c := New()
+	c.Attach("bot", s)
+	defer c.Close()
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.SendMessage("hello"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := srv.WaitForFrame(ctx, "MSG"); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if _, err := c.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `dggchat_sends_total{session="bot",type="MSG"} 1` + "\n"
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("expected metrics to contain %q, got:\n%s", want, b.String())
+	}
+}
+
+func TestLabels(t *testing.T) {
+	if got := labels("session", `a"b\c`); got != `{session="a\"b\\c"}` {
+		t.Errorf("unexpected escaped labels %s", got)
+	}
+	if got := withLabel(`{session="a"}`, "le", "1"); got != `{session="a",le="1"}` {
+		t.Errorf("unexpected labels %s", got)
+	}
+}
+
+func TestCollectorReattach(t *testing.T) {
+	s, _ := dggchat.New()
+	s.AddMessageHandler(func(dggchat.Message, *dggchat.Session) {})
+	c := New()
+	c.Attach("bot", s)
+	c.Attach("bot", s)
+	defer c.Close()
+
+	s.Dispatch([]byte(`MSG {"nick":"alice","data":"hi","timestamp":1}`), time.Now())
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`dggchat_frames_received_total{session="bot",type="MSG"} 1` + "\n",
+		`dggchat_handler_duration_seconds_count{session="bot",type="MSG"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestCollectorClose(t *testing.T) {
+	s, _ := dggchat.New()
+	c, other := New(), New()
+	c.Attach("bot", s)
+	other.Attach("bot", s)
+	defer other.Close()
+
+	c.Close()
+	if s.Observer() == nil {
+		t.Error("expected the observer of another collector to be kept")
+	}
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); strings.Contains(body, "dggchat_users") {
+		t.Errorf("expected closed sessions not to be served, got:\n%s", body)
+	}
+
+	other.Close()
+	if s.Observer() != nil {
+		t.Error("expected the observer to be removed")
+	}
+}
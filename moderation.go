@@ -0,0 +1,283 @@
+package dggchat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action is an action a user can take in chat, named after the protocol message type
+type Action string
+
+// Moderation actions
+const (
+	ActionMute   Action = "MUTE"
+	ActionUnmute Action = "UNMUTE"
+	ActionBan    Action = "BAN"
+	ActionUnban  Action = "UNBAN"
+)
+
+// DefaultModerationTimeout is the time a Moderator waits for the server to confirm an action
+const DefaultModerationTimeout = 5 * time.Second
+
+// ErrNotConfirmed is returned in a ModerationResult when the server did not confirm the action in time
+var ErrNotConfirmed = errors.New("moderation action was not confirmed by the server")
+
+// ModerationResult is the outcome of a single moderation action
+type ModerationResult struct {
+	Action Action
+	// Nick is the target of the action
+	Nick   string
+	Reason string
+	// Duration is the requested duration, 0 means the server default
+	Duration  time.Duration
+	Permanent bool
+	BanIP     bool
+	// Moderator is the nick of the user that took the action, if known
+	Moderator string
+	Timestamp time.Time
+	// Confirmed is true if the server announced the action to chat
+	Confirmed bool
+	// Err is set if the action could not be sent, or if the server rejected it or did not confirm it in time
+	Err error
+}
+
+// ModerationError is a ModerationResult error caused by an error message of the server
+type ModerationError struct {
+	// Description is the error sent by the server, e.g. ErrorNoPermission
+	Description string
+}
+
+func (e *ModerationError) Error() string {
+	return fmt.Sprintf("server rejected moderation action: %s", e.Description)
+}
+
+// moderationErrors are the error messages the server sends in response to moderation actions.
+// Other errors, e.g. ErrorThorttled, belong to chat messages sent at the same time.
+var moderationErrors = map[string]bool{
+	ErrorNoPermission:   true,
+	ErrorProtected:      true,
+	ErrorInvalidMessage: true,
+	ErrorNotFound:       true,
+	ErrorNeedBanReason:  true,
+}
+
+type pendingAction struct {
+	action Action
+	nick   string
+	done   chan ModerationResult
+}
+
+// A Moderator takes moderation actions through a session and waits for the server
+// to confirm them. Every action is recorded in an audit log.
+//
+// The server does not say which action an error message belongs to, so errors
+// only sent for moderation actions are attributed to the oldest unconfirmed action.
+// Actions block until they are confirmed, so they must not be called from a
+// handler of the same session, as handlers block reading further messages.
+type Moderator struct {
+	sync.Mutex
+	session *Session
+	timeout time.Duration
+	pending []*pendingAction
+	log     []ModerationResult
+	remove  func()
+}
+
+// NewModerator creates a moderator taking actions through the given session.
+func NewModerator(s *Session) *Moderator {
+	m := &Moderator{
+		session: s,
+		timeout: DefaultModerationTimeout,
+	}
+	m.remove = s.addListener(m.onEvent)
+	return m
+}
+
+// Close stops the moderator from observing the session.
+func (m *Moderator) Close() {
+	m.remove()
+}
+
+// SetTimeout changes how long to wait for the server to confirm an action
+func (m *Moderator) SetTimeout(timeout time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.timeout = timeout
+}
+
+// Mute mutes the user with the given nick.
+// If duration is <= 0, the server uses its built-in default duration
+func (m *Moderator) Mute(nick string, duration time.Duration, reason string) ModerationResult {
+	r := ModerationResult{Action: ActionMute, Nick: nick, Reason: reason, Duration: duration}
+	return m.do(r, func() error {
+		return m.session.SendMute(nick, duration)
+	})
+}
+
+// Unmute unmutes the user with the given nick.
+func (m *Moderator) Unmute(nick string, reason string) ModerationResult {
+	r := ModerationResult{Action: ActionUnmute, Nick: nick, Reason: reason}
+	return m.do(r, func() error {
+		return m.session.SendUnmute(nick)
+	})
+}
+
+// Ban bans the user with the given nick.
+// If duration is <= 0, the server uses its built-in default duration
+func (m *Moderator) Ban(nick string, reason string, duration time.Duration, banip bool) ModerationResult {
+	r := ModerationResult{Action: ActionBan, Nick: nick, Reason: reason, Duration: duration, BanIP: banip}
+	return m.do(r, func() error {
+		return m.session.SendBan(nick, reason, duration, banip)
+	})
+}
+
+// PermanentBan bans the user with the given nick permanently.
+func (m *Moderator) PermanentBan(nick string, reason string, banip bool) ModerationResult {
+	r := ModerationResult{Action: ActionBan, Nick: nick, Reason: reason, Permanent: true, BanIP: banip}
+	return m.do(r, func() error {
+		return m.session.SendPermanentBan(nick, reason, banip)
+	})
+}
+
+// Unban unbans the user with the given nick, this also removes mutes.
+func (m *Moderator) Unban(nick string, reason string) ModerationResult {
+	r := ModerationResult{Action: ActionUnban, Nick: nick, Reason: reason}
+	return m.do(r, func() error {
+		return m.session.SendUnban(nick)
+	})
+}
+
+// MuteAll mutes all given nicks one after another
+func (m *Moderator) MuteAll(nicks []string, duration time.Duration, reason string) []ModerationResult {
+	results := make([]ModerationResult, 0, len(nicks))
+	for _, nick := range nicks {
+		results = append(results, m.Mute(nick, duration, reason))
+	}
+	return results
+}
+
+// BanAll bans all given nicks one after another
+func (m *Moderator) BanAll(nicks []string, reason string, duration time.Duration, banip bool) []ModerationResult {
+	results := make([]ModerationResult, 0, len(nicks))
+	for _, nick := range nicks {
+		results = append(results, m.Ban(nick, reason, duration, banip))
+	}
+	return results
+}
+
+// UnbanAll unbans all given nicks one after another
+func (m *Moderator) UnbanAll(nicks []string, reason string) []ModerationResult {
+	results := make([]ModerationResult, 0, len(nicks))
+	for _, nick := range nicks {
+		results = append(results, m.Unban(nick, reason))
+	}
+	return results
+}
+
+// Log returns all actions taken by the moderator, oldest first
+func (m *Moderator) Log() []ModerationResult {
+	m.Lock()
+	defer m.Unlock()
+	l := make([]ModerationResult, len(m.log))
+	copy(l, m.log)
+	return l
+}
+
+func (m *Moderator) do(r ModerationResult, send func() error) ModerationResult {
+	r.Timestamp = time.Now()
+	if me, ok := m.session.Me(); ok {
+		r.Moderator = me.Nick
+	}
+
+	p := &pendingAction{
+		action: r.Action,
+		nick:   r.Nick,
+		done:   make(chan ModerationResult, 1),
+	}
+
+	m.Lock()
+	timeout := m.timeout
+	m.pending = append(m.pending, p)
+	m.Unlock()
+
+	if err := send(); err != nil {
+		m.removePending(p)
+		r.Err = err
+		return m.record(r)
+	}
+
+	select {
+	case confirmation := <-p.done:
+		r.Confirmed = confirmation.Confirmed
+		r.Err = confirmation.Err
+	case <-time.After(timeout):
+		m.removePending(p)
+		r.Err = ErrNotConfirmed
+	}
+
+	return m.record(r)
+}
+
+func (m *Moderator) record(r ModerationResult) ModerationResult {
+	m.Lock()
+	defer m.Unlock()
+	m.log = append(m.log, r)
+	return r
+}
+
+func (m *Moderator) removePending(p *pendingAction) {
+	m.Lock()
+	defer m.Unlock()
+	for i, pending := range m.pending {
+		if pending == p {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// resolve completes the first pending action for which match returns true.
+// call with locks held
+func (m *Moderator) resolve(result ModerationResult, match func(*pendingAction) bool) {
+	for i, p := range m.pending {
+		if match(p) {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			p.done <- result
+			return
+		}
+	}
+}
+
+func (m *Moderator) onEvent(e Event) {
+	if e.Historical {
+		return
+	}
+
+	var target User
+	switch data := e.Data.(type) {
+	case Mute:
+		target = data.Target
+	case Ban:
+		target = data.Target
+	case string:
+		if e.Type != "ERR" || !moderationErrors[data] {
+			return
+		}
+		m.Lock()
+		defer m.Unlock()
+		result := ModerationResult{Err: &ModerationError{Description: data}}
+		m.resolve(result, func(*pendingAction) bool { return true })
+		return
+	default:
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.resolve(ModerationResult{Confirmed: true}, func(p *pendingAction) bool {
+		return string(p.action) == e.Type && strings.EqualFold(p.nick, target.Nick)
+	})
+}
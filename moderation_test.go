@@ -0,0 +1,154 @@
+package dggchat
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestModeratorMatching(t *testing.T) {
+	type pending struct {
+		action Action
+		nick   string
+	}
+	tests := []struct {
+		name    string
+		pending []pending
+		frame   string
+		// resolved is the index of the resolved pending action, or -1
+		resolved  int
+		confirmed bool
+		err       string
+	}{
+		{"mute", []pending{{ActionMute, "alice"}}, `MUTE {"nick":"mod","data":"Alice","timestamp":1}`, 0, true, ""},
+		{"other target", []pending{{ActionMute, "alice"}}, `MUTE {"nick":"mod","data":"bob","timestamp":1}`, -1, false, ""},
+		{"other action", []pending{{ActionBan, "alice"}}, `MUTE {"nick":"mod","data":"alice","timestamp":1}`, -1, false, ""},
+		{"matching target", []pending{{ActionMute, "alice"}, {ActionMute, "bob"}}, `MUTE {"nick":"mod","data":"bob","timestamp":1}`, 1, true, ""},
+		{"unmute", []pending{{ActionMute, "alice"}, {ActionUnmute, "alice"}}, `UNMUTE {"nick":"mod","data":"alice","timestamp":1}`, 1, true, ""},
+		{"ban", []pending{{ActionBan, "alice"}}, `BAN {"nick":"mod","data":"alice","timestamp":1}`, 0, true, ""},
+		{"unban", []pending{{ActionUnban, "alice"}}, `UNBAN {"nick":"mod","data":"alice","timestamp":1}`, 0, true, ""},
+		{"error resolves oldest", []pending{{ActionBan, "alice"}, {ActionMute, "bob"}}, `ERR "nopermission"`, 0, false, ErrorNoPermission},
+		{"protected", []pending{{ActionMute, "alice"}}, `ERR "protectederror"`, 0, false, ErrorProtected},
+		{"error without pending", nil, `ERR "nopermission"`, -1, false, ""},
+		{"message error", []pending{{ActionMute, "alice"}}, `ERR "throttled"`, -1, false, ""},
+		{"duplicate message", []pending{{ActionMute, "alice"}}, `ERR "duplicate"`, -1, false, ""},
+		{"unrelated message", []pending{{ActionMute, "alice"}}, `MSG {"nick":"alice","data":"hi","timestamp":1}`, -1, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := New("key")
+			m := NewModerator(s)
+			defer m.Close()
+
+			var actions []*pendingAction
+			for _, p := range tt.pending {
+				a := &pendingAction{action: p.action, nick: p.nick, done: make(chan ModerationResult, 1)}
+				actions = append(actions, a)
+				m.pending = append(m.pending, a)
+			}
+
+			s.Dispatch([]byte(tt.frame), time.Now())
+
+			for i, a := range actions {
+				select {
+				case r := <-a.done:
+					if i != tt.resolved {
+						t.Fatalf("expected action %d not to be resolved", i)
+					}
+					if r.Confirmed != tt.confirmed {
+						t.Errorf("expected confirmed %v, got %v", tt.confirmed, r.Confirmed)
+					}
+					var me *ModerationError
+					if tt.err == "" && r.Err != nil {
+						t.Errorf("unexpected error %v", r.Err)
+					} else if tt.err != "" && (!errors.As(r.Err, &me) || me.Description != tt.err) {
+						t.Errorf("expected moderation error %q, got %v", tt.err, r.Err)
+					}
+				default:
+					if i == tt.resolved {
+						t.Fatalf("expected action %d to be resolved", i)
+					}
+				}
+			}
+
+			remaining := len(tt.pending)
+			if tt.resolved >= 0 {
+				remaining--
+			}
+			if len(m.pending) != remaining {
+				t.Errorf("expected %d pending actions, got %d", remaining, len(m.pending))
+			}
+		})
+	}
+}
+
+func TestModeratorNotSent(t *testing.T) {
+	s, _ := New()
+	m := NewModerator(s)
+	defer m.Close()
+
+	r := m.Mute("alice", time.Minute, "spam")
+	if !errors.Is(r.Err, ErrReadOnly) || r.Confirmed {
+		t.Errorf("expected read-only error, got %+v", r)
+	}
+	if len(m.pending) != 0 {
+		t.Error("expected actions that could not be sent not to stay pending")
+	}
+	if log := m.Log(); len(log) != 1 || log[0].Nick != "alice" || log[0].Reason != "spam" {
+		t.Errorf("unexpected audit log %+v", log)
+	}
+}
+
+func TestModeratorConcurrentMessage(t *testing.T) {
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/chat/me" {
+			_, _ = w.Write([]byte(`{"nick":"mod","features":["moderator"]}`))
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		// answer once both the message and the mute were received, the message is throttled
+		for i := 0; i < 2; i++ {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`ERR "throttled"`))
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`MUTE {"nick":"mod","data":"alice","timestamp":1}`))
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	u.Scheme, u.Path = "ws", "/ws"
+
+	s, _ := NewWithOptions(WithLoginKey("key"), WithBackend(ChatGo(*u)))
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := NewModerator(s)
+	defer m.Close()
+
+	results := make(chan ModerationResult, 1)
+	go func() { results <- m.Mute("alice", time.Minute, "spam") }()
+	if err := s.SendMessage("hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := <-results; !r.Confirmed || r.Err != nil {
+		t.Errorf("expected the mute to be confirmed despite the message error, got %+v", r)
+	}
+}
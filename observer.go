@@ -0,0 +1,29 @@
+package dggchat
+
+import "time"
+
+// An Observer is notified about the activity of a session that is not visible
+// through events, e.g. to collect metrics. Its methods must not block.
+type Observer interface {
+	// ObserveSend is called for every message written to the server, err is the write error if any
+	ObserveSend(mType string, err error)
+	// ObserveReconnect is called for every reconnect attempt, err is set if it failed
+	ObserveReconnect(err error)
+	// ObserveHandler is called with the time the handler of a received message took
+	ObserveHandler(mType string, d time.Duration)
+}
+
+// SetObserver sets the observer notified about the activity of the session,
+// nil removes it.
+func (s *Session) SetObserver(o Observer) {
+	s.Lock()
+	defer s.Unlock()
+	s.observer = o
+}
+
+// Observer returns the observer of the session, nil if none is set
+func (s *Session) Observer() Observer {
+	s.RLock()
+	defer s.RUnlock()
+	return s.observer
+}
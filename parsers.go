@@ -7,6 +7,63 @@ import (
 	"time"
 )
 
+// splitFrame splits a raw protocol message into its type and json content
+func splitFrame(frame []byte) (string, string, bool) {
+	mslice := strings.SplitN(string(frame), " ", 2)
+	if len(mslice) != 2 {
+		return "", "", false
+	}
+	return mslice[0], mslice[1], true
+}
+
+// parseEvent parses the content of a message of the given type.
+// Types that carry no information, or are unknown, return nil data and no error.
+func parseEvent(mType string, mContent string, sess *Session) (interface{}, error) {
+	switch mType {
+	case "MSG":
+		return parseMessage(mContent)
+	case "PIN":
+		return parsePin(mContent)
+	case "SUBSCRIPTION", "GIFTSUB", "MASSGIFT":
+		return parseSubscription(mContent)
+	case "DONATION":
+		return parseDonation(mContent)
+	case "MUTE", "UNMUTE":
+		return parseMute(mContent, sess)
+	case "BAN", "UNBAN":
+		return parseBan(mContent, sess)
+	case "SUBONLY":
+		return parseSubOnly(mContent)
+	case "BROADCAST":
+		return parseBroadcast(mContent)
+	case "PRIVMSG":
+		return parsePrivateMessage(mContent, sess)
+	case "PONG":
+		return parsePing(mContent)
+	case "ERR":
+		return parseErrorMessage(mContent), nil
+	case "NAMES":
+		return parseNames(mContent)
+	case "JOIN", "QUIT":
+		return parseRoomAction(mContent)
+	case "UPDATEUSER":
+		return parseUpdateUser(mContent)
+	}
+
+	// PRIVMSGSENT confirms sending of a PM was successful.
+	// If not successful, an ERR message is sent anyways.
+	// PING and REFRESH carry no information either.
+	return nil, nil
+}
+
+// lookupUser finds the user in the chat room state of sess, which may be nil
+func lookupUser(sess *Session, nick string) (User, bool) {
+	if sess == nil {
+		return User{}, false
+	}
+	return sess.GetUser(nick)
+}
+
 func parseMessage(s string) (Message, error) {
 	var m message
 	err := json.Unmarshal([]byte(s), &m)
@@ -60,10 +117,17 @@ func parseMute(s string, sess *Session) (Mute, error) {
 	if err != nil {
 		return Mute{}, err
 	}
+	var mm mute
+	if err := json.Unmarshal([]byte(s), &mm); err != nil {
+		return Mute{}, err
+	}
 
 	// Try to get features of target, if they are currently online
 	targetNick := m.Message
-	u, online := sess.GetUser(targetNick)
+	u, online := lookupUser(sess, targetNick)
+	if !online {
+		u.Nick = targetNick
+	}
 
 	mute := Mute{
 		Sender:    m.Sender,
@@ -75,7 +139,8 @@ func parseMute(s string, sess *Session) (Mute, error) {
 			CreatedDate: u.CreatedDate,
 			Watching:    u.Watching,
 		},
-		Online: online,
+		Online:   online,
+		Duration: time.Duration(mm.Duration) * time.Second,
 	}
 
 	return mute, nil
@@ -89,7 +154,10 @@ func parseBan(s string, sess *Session) (Ban, error) {
 
 	// Try to get features of target, if they are currently online
 	targetNick := m.Message
-	u, online := sess.GetUser(targetNick)
+	u, online := lookupUser(sess, targetNick)
+	if !online {
+		u.Nick = targetNick
+	}
 
 	ban := Ban{
 		Sender:    m.Sender,
@@ -150,6 +218,15 @@ func parseUpdateUser(s string) (User, error) {
 }
 
 func parseErrorMessage(s string) string {
+	// errors are usually a json string, newer servers may send an object with a description
+	var description string
+	if err := json.Unmarshal([]byte(s), &description); err == nil {
+		return description
+	}
+	var e errorMessage
+	if err := json.Unmarshal([]byte(s), &e); err == nil && e.Description != "" {
+		return e.Description
+	}
 	return strings.Replace(s, `"`, "", -1)
 }
 
@@ -171,7 +248,7 @@ func parsePrivateMessage(s string, sess *Session) (PrivateMessage, error) {
 		Timestamp: unixToTime(pm.Timestamp),
 	}
 
-	u, found := sess.GetUser(privateMessage.User.Nick)
+	u, found := lookupUser(sess, privateMessage.User.Nick)
 	if found {
 		privateMessage.User = u
 	}
@@ -180,13 +257,26 @@ func parsePrivateMessage(s string, sess *Session) (PrivateMessage, error) {
 }
 
 func parseBroadcast(s string) (Broadcast, error) {
-	var m Broadcast
+	var b broadcast
 
-	if err := json.Unmarshal([]byte(s), &m); err != nil {
+	if err := json.Unmarshal([]byte(s), &b); err != nil {
 		return Broadcast{}, err
 	}
 
-	return m, nil
+	broadcast := Broadcast{
+		Sender: User{
+			ID:          b.ID,
+			Nick:        b.Nick,
+			Features:    b.Features,
+			CreatedDate: b.CreatedDate,
+			Watching:    b.Watching,
+		},
+		Timestamp: unixToTime(b.Timestamp),
+		Message:   b.Data,
+		UUID:      b.UUID,
+	}
+
+	return broadcast, nil
 }
 
 func parseSubscription(s string) (Subscription, error) {
@@ -262,6 +352,12 @@ func parseSubOnly(s string) (SubOnly, error) {
 func parsePing(s string) (Ping, error) {
 	var p Ping
 
+	// some servers send the ping payload as plain json instead of base64
+	if strings.HasPrefix(strings.TrimSpace(s), "{") {
+		err := json.Unmarshal([]byte(s), &p)
+		return p, err
+	}
+
 	s = strings.Replace(s, `"`, "", -1)
 
 	decoded, err := base64.StdEncoding.DecodeString(s)
@@ -282,5 +378,5 @@ func unixToTime(stamp int64) time.Time {
 }
 
 func timeToUnix(t time.Time) int64 {
-	return t.Unix() * 1000
+	return t.UnixMilli()
 }
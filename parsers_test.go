@@ -0,0 +1,312 @@
+package dggchat
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestMain(m *testing.M) {
+	// parsed timestamps are in local time, keep the golden files independent of the machine
+	time.Local = time.UTC
+	os.Exit(m.Run())
+}
+
+// readFrames returns the captured frames in testdata/frames, keyed by file name without extension
+func readFrames(tb testing.TB) map[string][]byte {
+	tb.Helper()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "frames", "*.txt"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	frames := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		frames[name] = bytes.TrimRight(b, "\n")
+	}
+	return frames
+}
+
+func TestDispatchGolden(t *testing.T) {
+	for name, frame := range readFrames(t) {
+		t.Run(name, func(t *testing.T) {
+			s, _ := New()
+
+			var events []Event
+			s.AddEventListener(func(e Event, _ *Session) {
+				events = append(events, e)
+			})
+			s.Dispatch(frame, time.Time{})
+
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(events))
+			}
+			e := events[0]
+			if e.Err != nil {
+				t.Fatalf("unexpected parse error: %v", e.Err)
+			}
+
+			got, err := json.MarshalIndent(struct {
+				Type string
+				Data interface{}
+			}{e.Type, e.Data}, "", "\t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "golden", name+".json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("parsed %s differs from %s:\ngot:\n%s\nwant:\n%s", name, golden, got, want)
+			}
+		})
+	}
+}
+
+func TestParseMuteTarget(t *testing.T) {
+	frames := readFrames(t)
+	s, _ := New()
+
+	tests := []struct {
+		name     string
+		names    bool
+		online   bool
+		features []string
+	}{
+		{name: "offline", names: false, online: false},
+		{name: "online", names: true, online: true, features: []string{"subscriber", "flair1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.names {
+				s.Dispatch(frames["names"], time.Now())
+			}
+			_, content, _ := splitFrame(frames["mute"])
+			mute, err := parseMute(content, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mute.Target.Nick != "alice" {
+				t.Errorf("expected target alice, got %q", mute.Target.Nick)
+			}
+			if mute.Online != tt.online {
+				t.Errorf("expected online %v, got %v", tt.online, mute.Online)
+			}
+			if strings.Join(mute.Target.Features, ",") != strings.Join(tt.features, ",") {
+				t.Errorf("expected features %v, got %v", tt.features, mute.Target.Features)
+			}
+		})
+	}
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`"duplicate"`, ErrorDuplicate},
+		{`{"description":"muted","muteTimeLeft":540}`, ErrorMuted},
+		{`needlogin`, ErrorNeedLogin},
+		{`"throttled`, ErrorThorttled},
+		{`""`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseErrorMessage(tt.in); got != tt.want {
+			t.Errorf("parseErrorMessage(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParsePing(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: `"eyJ0aW1lc3RhbXAiOjE3MDAwMDAwMTYwMDB9"`, want: 1700000016000},
+		{in: `eyJ0aW1lc3RhbXAiOjE3MDAwMDAwMTYwMDB9`, want: 1700000016000},
+		{in: `{"timestamp":1700000016000}`, want: 1700000016000},
+		{in: `"not base64!"`, wantErr: true},
+		{in: `"bm90IGpzb24="`, wantErr: true},
+		{in: ``, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		p, err := parsePing(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePing(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if p.Timestamp != tt.want {
+			t.Errorf("parsePing(%q) = %d, want %d", tt.in, p.Timestamp, tt.want)
+		}
+	}
+}
+
+func TestSplitFrame(t *testing.T) {
+	tests := []struct {
+		in          string
+		wantType    string
+		wantContent string
+		wantOK      bool
+	}{
+		{`MSG {"data":"a b"}`, "MSG", `{"data":"a b"}`, true},
+		{`ERR "duplicate"`, "ERR", `"duplicate"`, true},
+		{`PRIVMSGSENT `, "PRIVMSGSENT", "", true},
+		{`REFRESH`, "", "", false},
+		{``, "", "", false},
+	}
+
+	for _, tt := range tests {
+		mType, content, ok := splitFrame([]byte(tt.in))
+		if mType != tt.wantType || content != tt.wantContent || ok != tt.wantOK {
+			t.Errorf("splitFrame(%q) = %q, %q, %v, want %q, %q, %v",
+				tt.in, mType, content, ok, tt.wantType, tt.wantContent, tt.wantOK)
+		}
+	}
+}
+
+// addFrameSeeds adds the content of all captured frames as fuzzing seeds
+func addFrameSeeds(f *testing.F) {
+	for _, frame := range readFrames(f) {
+		_, content, _ := splitFrame(frame)
+		f.Add(content)
+	}
+}
+
+func FuzzSplitFrame(f *testing.F) {
+	for _, frame := range readFrames(f) {
+		f.Add(string(frame))
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		mType, content, ok := splitFrame([]byte(in))
+		if ok && mType+" "+content != in {
+			t.Errorf("splitFrame(%q) lost data: %q %q", in, mType, content)
+		}
+	})
+}
+
+func FuzzParseMessage(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseMessage(in)
+	})
+}
+
+func FuzzParsePin(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parsePin(in)
+	})
+}
+
+func FuzzParseMute(f *testing.F) {
+	addFrameSeeds(f)
+	s, _ := New()
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseMute(in, s)
+	})
+}
+
+func FuzzParseBan(f *testing.F) {
+	addFrameSeeds(f)
+	s, _ := New()
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseBan(in, s)
+	})
+}
+
+func FuzzParseNames(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseNames(in)
+	})
+}
+
+func FuzzParseRoomAction(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseRoomAction(in)
+	})
+}
+
+func FuzzParseUpdateUser(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseUpdateUser(in)
+	})
+}
+
+func FuzzParseErrorMessage(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_ = parseErrorMessage(in)
+	})
+}
+
+func FuzzParsePrivateMessage(f *testing.F) {
+	addFrameSeeds(f)
+	s, _ := New()
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parsePrivateMessage(in, s)
+	})
+}
+
+func FuzzParseBroadcast(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseBroadcast(in)
+	})
+}
+
+func FuzzParseSubscription(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseSubscription(in)
+	})
+}
+
+func FuzzParseDonation(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseDonation(in)
+	})
+}
+
+func FuzzParseSubOnly(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parseSubOnly(in)
+	})
+}
+
+func FuzzParsePing(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, in string) {
+		_, _ = parsePing(in)
+	})
+}
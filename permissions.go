@@ -0,0 +1,151 @@
+package dggchat
+
+import "errors"
+
+// Role is the highest rank of a user in chat
+type Role int
+
+// Roles ordered from lowest to highest rank
+const (
+	RoleUser Role = iota
+	RoleSubscriber
+	RoleVIP
+	RoleModerator
+	RoleAdmin
+)
+
+// Non-moderation actions, see also the moderation actions
+const (
+	ActionMessage        Action = "MSG"
+	ActionPrivateMessage Action = "PRIVMSG"
+	ActionBroadcast      Action = "BROADCAST"
+	ActionSubOnly        Action = "SUBONLY"
+)
+
+// ErrNoPermission is thrown when the session's user is not allowed to take an action
+var ErrNoPermission = errors.New("no permission for this action")
+
+// ErrProtected is thrown when attempting to take a moderation action against a protected user
+var ErrProtected = errors.New("target user is protected")
+
+// subTiers maps the flair features to subscription tiers
+var subTiers = []struct {
+	feature string
+	tier    int
+}{
+	{FeatureTier4, 4},
+	{FeatureTier3, 3},
+	{FeatureTier2, 2},
+	{FeatureTier1, 1},
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleSubscriber:
+		return "subscriber"
+	case RoleVIP:
+		return "vip"
+	case RoleModerator:
+		return "moderator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "user"
+	}
+}
+
+// IsAdmin returns true if the user is a chat administrator
+func (u *User) IsAdmin() bool {
+	return u.HasFeature(FeatureAdministrator)
+}
+
+// IsMod returns true if the user is a chat moderator.
+// Administrators are considered moderators as well.
+func (u *User) IsMod() bool {
+	return u.HasFeature(FeatureModerator) || u.IsAdmin()
+}
+
+// IsVIP returns true if the user is a vip
+func (u *User) IsVIP() bool {
+	return u.HasFeature(FeatureVIP)
+}
+
+// IsSubscriber returns true if the user has an active subscription
+func (u *User) IsSubscriber() bool {
+	return u.HasFeature(FeatureSubscriber) || u.SubTier() > 0
+}
+
+// SubTier returns the subscription tier (1 to 4) of the user,
+// or 0 if the user is not subscribed
+func (u *User) SubTier() int {
+	for _, t := range subTiers {
+		if u.HasFeature(t.feature) {
+			return t.tier
+		}
+	}
+	return 0
+}
+
+// IsProtected returns true if the user can not be muted or banned by moderators
+func (u *User) IsProtected() bool {
+	return u.HasFeature(FeatureProtected)
+}
+
+// IsBot returns true if the user is marked as a bot
+func (u *User) IsBot() bool {
+	return u.HasFeature(FeatureBot) || u.HasFeature(FeatureBot2)
+}
+
+// Role returns the highest role of the user
+func (u *User) Role() Role {
+	switch {
+	case u.IsAdmin():
+		return RoleAdmin
+	case u.IsMod():
+		return RoleModerator
+	case u.IsVIP():
+		return RoleVIP
+	case u.IsSubscriber():
+		return RoleSubscriber
+	default:
+		return RoleUser
+	}
+}
+
+// Can checks whether the session is allowed to take the given action against the
+// target nick, which may be empty for actions without a target.
+// If our own user is not known yet, the server has the final say and only the
+// target is checked. Returns nil if the action is allowed.
+func (s *Session) Can(action Action, target string) error {
+	s.RLock()
+	readOnly := s.readOnly
+	s.RUnlock()
+	if readOnly {
+		return ErrReadOnly
+	}
+
+	me, known := s.Me()
+
+	switch action {
+	case ActionMute, ActionUnmute, ActionBan, ActionUnban:
+		if known && !me.IsMod() {
+			return ErrNoPermission
+		}
+		if action == ActionMute || action == ActionBan {
+			u, online := s.GetUser(target)
+			if online && u.IsProtected() && !(known && me.IsAdmin()) {
+				return ErrProtected
+			}
+		}
+	case ActionSubOnly:
+		if known && !me.IsMod() {
+			return ErrNoPermission
+		}
+	case ActionBroadcast:
+		if known && !me.IsAdmin() {
+			return ErrNoPermission
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package dggchat
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	tests := []struct {
+		features   []string
+		role       Role
+		tier       int
+		subscriber bool
+		bot        bool
+	}{
+		{nil, RoleUser, 0, false, false},
+		{[]string{FeatureSubscriber}, RoleSubscriber, 0, true, false},
+		{[]string{FeatureTier1}, RoleSubscriber, 1, true, false},
+		{[]string{FeatureSubscriber, FeatureTier2}, RoleSubscriber, 2, true, false},
+		{[]string{FeatureTier1, FeatureTier3}, RoleSubscriber, 3, true, false},
+		{[]string{FeatureTier4, FeatureTier2}, RoleSubscriber, 4, true, false},
+		{[]string{FeatureVIP, FeatureTier1}, RoleVIP, 1, true, false},
+		{[]string{FeatureModerator, FeatureVIP}, RoleModerator, 0, false, false},
+		{[]string{FeatureAdministrator}, RoleAdmin, 0, false, false},
+		{[]string{FeatureAdministrator, FeatureModerator}, RoleAdmin, 0, false, false},
+		{[]string{FeatureBot}, RoleUser, 0, false, true},
+		{[]string{FeatureBot2}, RoleUser, 0, false, true},
+		{[]string{FeatureNotable, FeatureTwitch}, RoleUser, 0, false, false},
+	}
+	for _, tt := range tests {
+		u := User{Nick: "alice", Features: tt.features}
+		if role := u.Role(); role != tt.role {
+			t.Errorf("%v: expected role %s, got %s", tt.features, tt.role, role)
+		}
+		if tier := u.SubTier(); tier != tt.tier {
+			t.Errorf("%v: expected tier %d, got %d", tt.features, tt.tier, tier)
+		}
+		if u.IsSubscriber() != tt.subscriber {
+			t.Errorf("%v: expected subscriber %v", tt.features, tt.subscriber)
+		}
+		if u.IsBot() != tt.bot {
+			t.Errorf("%v: expected bot %v", tt.features, tt.bot)
+		}
+	}
+
+	admin := User{Features: []string{FeatureAdministrator}}
+	if !admin.IsMod() {
+		t.Error("expected administrators to be moderators")
+	}
+	if RoleAdmin.String() != "admin" || Role(42).String() != "user" {
+		t.Error("unexpected role names")
+	}
+}
+
+func TestCan(t *testing.T) {
+	user := &User{Nick: "me"}
+	mod := &User{Nick: "me", Features: []string{FeatureModerator}}
+	admin := &User{Nick: "me", Features: []string{FeatureAdministrator}}
+
+	tests := []struct {
+		name   string
+		me     *User
+		action Action
+		target string
+		err    error
+	}{
+		{"message", user, ActionMessage, "", nil},
+		{"private message", user, ActionPrivateMessage, "alice", nil},
+		{"user mutes", user, ActionMute, "alice", ErrNoPermission},
+		{"user unbans", user, ActionUnban, "alice", ErrNoPermission},
+		{"user sets sub only", user, ActionSubOnly, "", ErrNoPermission},
+		{"mod mutes", mod, ActionMute, "alice", nil},
+		{"mod bans", mod, ActionBan, "alice", nil},
+		{"mod mutes protected", mod, ActionMute, "protected", ErrProtected},
+		{"mod bans protected", mod, ActionBan, "Protected", ErrProtected},
+		{"mod unmutes protected", mod, ActionUnmute, "protected", nil},
+		{"mod mutes offline user", mod, ActionMute, "offline", nil},
+		{"mod sets sub only", mod, ActionSubOnly, "", nil},
+		{"mod broadcasts", mod, ActionBroadcast, "", ErrNoPermission},
+		{"admin mutes protected", admin, ActionMute, "protected", nil},
+		{"admin broadcasts", admin, ActionBroadcast, "", nil},
+		{"unknown user mutes", nil, ActionMute, "alice", nil},
+		{"unknown user mutes protected", nil, ActionMute, "protected", ErrProtected},
+		{"unknown user broadcasts", nil, ActionBroadcast, "", nil},
+	}
+	for _, tt := range tests {
+		s, _ := New("key")
+		s.state.users = []User{
+			{Nick: "alice"},
+			{Nick: "protected", Features: []string{FeatureProtected}},
+		}
+		if tt.me != nil {
+			s.state.setMe(*tt.me)
+		}
+		if err := s.Can(tt.action, tt.target); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+
+	readOnly, _ := New()
+	if err := readOnly.Can(ActionMessage, ""); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected read-only sessions not to be able to send, got %v", err)
+	}
+}
+
+// TestLoginWhileSending is meant to be run with the race detector
+func TestLoginWhileSending(t *testing.T) {
+	s, _ := New()
+	done := make(chan struct{})
+	go func() {
+		s.SetSessionCookie("sid", "")
+		close(done)
+	}()
+	_ = s.Can(ActionMute, "alice")
+	_ = s.SendMessage("hi")
+	// canceled, so no request is made once logged in
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = s.MarkPrivateMessageRead(ctx, 1)
+	<-done
+}
@@ -0,0 +1,218 @@
+// Package pool runs many chat sessions, e.g. of several bot accounts, together.
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/MemeLabs/dggchat/metrics"
+	"github.com/gorilla/websocket"
+)
+
+// DefaultStagger is the time waited between opening two sessions, when a config does not specify it.
+// Opening many connections at once is rejected by the server with dggchat.ErrorTooManyConnections.
+const DefaultStagger = 2 * time.Second
+
+// ErrDuplicateSession is returned when adding a session with a name that is already used
+var ErrDuplicateSession = errors.New("a session with this name already exists")
+
+// ErrNoSession is returned when a session with the given name does not exist
+var ErrNoSession = errors.New("no session with this name")
+
+// Config configures a Pool
+type Config struct {
+	// Dialer is used by all sessions, if set
+	Dialer *websocket.Dialer
+	// Metrics collects metrics of all sessions labeled with their name, if set
+	Metrics *metrics.Collector
+	// Stagger is the time waited between opening two sessions
+	Stagger time.Duration
+}
+
+// Event is an event received by one of the sessions of a pool
+type Event struct {
+	dggchat.Event
+	// Session is the name of the session that received the event
+	Session string
+}
+
+type member struct {
+	name    string
+	session *dggchat.Session
+	remove  func()
+}
+
+// A Pool owns sessions keyed by name, and opens and closes them together.
+// It is safe for concurrent use.
+type Pool struct {
+	sync.Mutex
+	config    Config
+	members   []*member
+	next      int
+	listeners map[int]func(Event)
+}
+
+// New creates an empty pool
+func New(c Config) *Pool {
+	if c.Stagger <= 0 {
+		c.Stagger = DefaultStagger
+	}
+	return &Pool{
+		config:    c,
+		listeners: make(map[int]func(Event)),
+	}
+}
+
+// Add adds a session to the pool. The session is opened by *pool.Open(), or can be opened
+// directly if the pool was opened already.
+func (p *Pool) Add(name string, s *dggchat.Session) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.find(name) != nil {
+		return ErrDuplicateSession
+	}
+
+	if p.config.Dialer != nil {
+		s.SetDialer(*p.config.Dialer)
+	}
+	if p.config.Metrics != nil {
+		p.config.Metrics.Attach(name, s)
+	}
+	remove := s.AddEventListener(func(e dggchat.Event, _ *dggchat.Session) {
+		p.emit(Event{Event: e, Session: name})
+	})
+
+	p.members = append(p.members, &member{name: name, session: s, remove: remove})
+	return nil
+}
+
+// Remove closes the session with the given name and removes it from the pool
+func (p *Pool) Remove(name string) error {
+	p.Lock()
+	m := p.find(name)
+	if m == nil {
+		p.Unlock()
+		return ErrNoSession
+	}
+	for i := range p.members {
+		if p.members[i] == m {
+			p.members = append(p.members[:i], p.members[i+1:]...)
+			break
+		}
+	}
+	p.Unlock()
+
+	m.remove()
+	if p.config.Metrics != nil {
+		p.config.Metrics.Detach(name)
+	}
+	return m.session.Close()
+}
+
+// Session returns the session with the given name.
+// If it does not exist, false is returned as the second parameter.
+func (p *Pool) Session(name string) (*dggchat.Session, bool) {
+	p.Lock()
+	defer p.Unlock()
+	if m := p.find(name); m != nil {
+		return m.session, true
+	}
+	return nil, false
+}
+
+// Names returns the names of all sessions, in the order they were added
+func (p *Pool) Names() []string {
+	p.Lock()
+	defer p.Unlock()
+	names := make([]string, len(p.members))
+	for i, m := range p.members {
+		names[i] = m.name
+	}
+	return names
+}
+
+// Open opens all sessions in the order they were added, waiting between each to avoid
+// being rejected for too many connections. Sessions that fail to open do not stop the others,
+// their errors are returned together. Cancelling the context stops opening further sessions.
+func (p *Pool) Open(ctx context.Context) error {
+	var errs []error
+	for i, m := range p.snapshot() {
+		if i > 0 {
+			select {
+			case <-time.After(p.config.Stagger):
+			case <-ctx.Done():
+				return errors.Join(append(errs, ctx.Err())...)
+			}
+		}
+
+		if err := m.session.Open(); err != nil && !errors.Is(err, dggchat.ErrAlreadyOpen) {
+			errs = append(errs, fmt.Errorf("session %s: %w", m.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all sessions, errors are returned together
+func (p *Pool) Close() error {
+	var errs []error
+	for _, m := range p.snapshot() {
+		if err := m.session.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", m.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AddEventListener adds a function that will be called for every event received by any
+// session of the pool. It is called from the goroutines of the sessions, possibly concurrently.
+// Returns a function that removes the listener again.
+func (p *Pool) AddEventListener(fn func(Event)) func() {
+	p.Lock()
+	defer p.Unlock()
+
+	id := p.next
+	p.next++
+	p.listeners[id] = fn
+
+	return func() {
+		p.Lock()
+		defer p.Unlock()
+		delete(p.listeners, id)
+	}
+}
+
+func (p *Pool) emit(e Event) {
+	p.Lock()
+	fns := make([]func(Event), 0, len(p.listeners))
+	for _, fn := range p.listeners {
+		fns = append(fns, fn)
+	}
+	p.Unlock()
+
+	for _, fn := range fns {
+		fn(e)
+	}
+}
+
+func (p *Pool) snapshot() []*member {
+	p.Lock()
+	defer p.Unlock()
+	members := make([]*member, len(p.members))
+	copy(members, p.members)
+	return members
+}
+
+// call with locks held
+func (p *Pool) find(name string) *member {
+	for _, m := range p.members {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
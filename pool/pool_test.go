@@ -0,0 +1,83 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/MemeLabs/dggchat/dggchattest"
+	"github.com/MemeLabs/dggchat/metrics"
+)
+
+func TestPool(t *testing.T) {
+	srv := dggchattest.NewServer()
+	defer srv.Close()
+
+	p := New(Config{Metrics: metrics.New(), Stagger: 50 * time.Millisecond})
+	for _, name := range []string{"a", "b"} {
+		s, _ := dggchat.New()
+		s.SetURL(srv.URL())
+		if err := p.Add(name, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, _ := dggchat.New()
+	if err := p.Add("a", s); !errors.Is(err, ErrDuplicateSession) {
+		t.Errorf("expected ErrDuplicateSession, got %v", err)
+	}
+
+	var mu sync.Mutex
+	received := make(map[string]int)
+	p.AddEventListener(func(e Event) {
+		if e.Type == "MSG" {
+			mu.Lock()
+			received[e.Session]++
+			mu.Unlock()
+		}
+	})
+
+	start := time.Now()
+	if err := p.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("expected connections to be staggered")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.WaitForConnections(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.SendMessage(dggchat.User{Nick: "alice"}, "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		mu.Lock()
+		done := received["a"] == 1 && received["b"] == 1
+		mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected a message tagged for each session, got %v", received)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if err := p.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if names := p.Names(); len(names) != 1 || names[0] != "b" {
+		t.Errorf("unexpected names after remove %v", names)
+	}
+	if err := p.Remove("a"); !errors.Is(err, ErrNoSession) {
+		t.Errorf("expected ErrNoSession, got %v", err)
+	}
+}
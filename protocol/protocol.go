@@ -0,0 +1,70 @@
+// Package protocol encodes and decodes the messages of the destinygg chat protocol.
+//
+// Every message is a type followed by a space and a json payload, e.g.
+//
+//	MSG {"nick":"Destiny","features":["admin"],"timestamp":1700000000000,"data":"hello"}
+//
+// Decoded events carry the same types handlers of a dggchat.Session receive, so
+// fake servers, relays and recordings can produce and consume them without
+// duplicating the protocol structures.
+//
+// Encode and Decode use the implementation of package dggchat, which registers it when
+// initialized. This package imports dggchat, so that always happens before they are used.
+package protocol
+
+import (
+	"github.com/MemeLabs/dggchat"
+	"github.com/MemeLabs/dggchat/internal/codec"
+)
+
+// Message types sent by the server
+const (
+	TypeMessage        = "MSG"
+	TypePin            = "PIN"
+	TypeNames          = "NAMES"
+	TypeJoin           = "JOIN"
+	TypeQuit           = "QUIT"
+	TypeUpdateUser     = "UPDATEUSER"
+	TypeMute           = "MUTE"
+	TypeUnmute         = "UNMUTE"
+	TypeBan            = "BAN"
+	TypeUnban          = "UNBAN"
+	TypeSubOnly        = "SUBONLY"
+	TypeBroadcast      = "BROADCAST"
+	TypePrivateMessage = "PRIVMSG"
+	TypePrivateSent    = "PRIVMSGSENT"
+	TypeSubscription   = "SUBSCRIPTION"
+	TypeGiftSub        = "GIFTSUB"
+	TypeMassGift       = "MASSGIFT"
+	TypeDonation       = "DONATION"
+	TypePing           = "PING"
+	TypePong           = "PONG"
+	TypeError          = "ERR"
+	TypeRefresh        = "REFRESH"
+)
+
+// Event is a decoded protocol message, see dggchat.Event
+type Event = dggchat.Event
+
+// ErrMalformedFrame is thrown when decoding a protocol message without type or content
+var ErrMalformedFrame = codec.ErrMalformedFrame
+
+// ErrUnknownEvent is thrown when encoding an event whose type can not be determined
+var ErrUnknownEvent = codec.ErrUnknownEvent
+
+// Encode serializes an event into a protocol message, as the server would send it.
+// If the type of the event is empty, it is derived from its data,
+// e.g. "MSG" for a dggchat.Message or "ERR" for a string.
+func Encode(e Event) ([]byte, error) {
+	return codec.Encode(e)
+}
+
+// Decode parses a protocol message into an event.
+// Targets of mutes and bans and senders of private messages only have their nick set.
+func Decode(frame []byte) (Event, error) {
+	e, err := codec.Decode(frame)
+	if err != nil {
+		return Event{}, err
+	}
+	return e.(Event), nil
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestRoundTrip(t *testing.T) {
+	at := time.UnixMilli(1700000000000)
+	alice := dggchat.User{Nick: "alice", Features: []string{dggchat.FeatureSubscriber}}
+
+	tests := []struct {
+		typ  string
+		data interface{}
+	}{
+		{TypeMessage, dggchat.Message{Sender: alice, Timestamp: at, Message: "hello"}},
+		{TypeMute, dggchat.Mute{Sender: alice, Timestamp: at, Target: dggchat.User{Nick: "bob"}, Duration: time.Minute}},
+		{TypeBan, dggchat.Ban{Sender: alice, Timestamp: at, Target: dggchat.User{Nick: "bob"}}},
+		{TypeBroadcast, dggchat.Broadcast{Sender: alice, Timestamp: at, Message: "hi chat"}},
+		{TypeError, dggchat.ErrorThorttled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ, func(t *testing.T) {
+			frame, err := Encode(Event{Data: tt.data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := Decode(frame)
+			if err != nil {
+				t.Fatalf("decoding %s: %v", frame, err)
+			}
+			if e.Type != tt.typ {
+				t.Errorf("expected type %s, got %s", tt.typ, e.Type)
+			}
+			if !reflect.DeepEqual(e.Data, tt.data) {
+				t.Errorf("round trip changed data:\ngot:  %+v\nwant: %+v", e.Data, tt.data)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Decode([]byte("MSG")); err != ErrMalformedFrame {
+		t.Errorf("expected ErrMalformedFrame, got %v", err)
+	}
+	if _, err := Encode(Event{Data: 42}); err != ErrUnknownEvent {
+		t.Errorf("expected ErrUnknownEvent, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+// Package record captures the raw messages received by a session into a JSON lines file,
+// and replays such recordings into a session's handlers without a network connection.
+//
+// Every line of a recording is a Frame:
+//
+//	{"type":"MSG","payload":"{\"nick\":\"Destiny\",...}","time":"2006-01-02T15:04:05.999Z"}
+//
+// Files ending in ".gz" are gzip compressed.
+package record
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/MemeLabs/dggchat/protocol"
+)
+
+// Frame is a single recorded protocol message
+type Frame struct {
+	Type     string    `json:"type"`
+	Payload  string    `json:"payload"`
+	Received time.Time `json:"time"`
+}
+
+// Bytes returns the frame as it was received from the server
+func (f Frame) Bytes() []byte {
+	return []byte(f.Type + " " + f.Payload)
+}
+
+// Event decodes the frame, see protocol.Decode
+func (f Frame) Event() (dggchat.Event, error) {
+	e, err := protocol.Decode(f.Bytes())
+	e.Received = f.Received
+	return e, err
+}
+
+// A Recorder writes frames as JSON lines. It is safe for concurrent use.
+type Recorder struct {
+	sync.Mutex
+	enc     *json.Encoder
+	closers []io.Closer
+	remove  []func()
+}
+
+// NewRecorder creates a recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Create creates or truncates the named file and returns a recorder writing to it.
+// If the name ends in ".gz", the recording is gzip compressed.
+func Create(name string) (*Recorder, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		r := NewRecorder(f)
+		r.closers = []io.Closer{f}
+		return r, nil
+	}
+
+	gz := gzip.NewWriter(f)
+	r := NewRecorder(gz)
+	r.closers = []io.Closer{gz, f}
+	return r, nil
+}
+
+// Attach starts recording every message received by the session.
+// Events replayed from the chat history are not recorded.
+func (r *Recorder) Attach(s *dggchat.Session) {
+	remove := s.AddEventListener(func(e dggchat.Event, _ *dggchat.Session) {
+		if e.Historical {
+			return
+		}
+		_ = r.Record(Frame{Type: e.Type, Payload: e.Payload, Received: e.Received})
+	})
+
+	r.Lock()
+	defer r.Unlock()
+	r.remove = append(r.remove, remove)
+}
+
+// Record writes a single frame
+func (r *Recorder) Record(f Frame) error {
+	r.Lock()
+	defer r.Unlock()
+	return r.enc.Encode(f)
+}
+
+// Close stops recording and closes the underlying file, if the recorder was created with Create
+func (r *Recorder) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, remove := range r.remove {
+		remove()
+	}
+	r.remove = nil
+
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	r.closers = nil
+	return err
+}
+
+// A Reader reads frames from a recording
+type Reader struct {
+	r       *bufio.Reader
+	closers []io.Closer
+}
+
+// NewReader creates a reader for the recording in r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Open opens the named recording, files ending in ".gz" are decompressed
+func Open(name string) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		r := NewReader(f)
+		r.closers = []io.Closer{f}
+		return r, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	r := NewReader(gz)
+	r.closers = []io.Closer{gz, f}
+	return r, nil
+}
+
+// Next returns the next frame of the recording, or io.EOF at its end
+func (r *Reader) Next() (Frame, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) == 0 {
+			if err != nil {
+				return Frame{}, err
+			}
+			continue
+		}
+
+		var f Frame
+		if jerr := json.Unmarshal(line, &f); jerr != nil {
+			return Frame{}, jerr
+		}
+		return f, nil
+	}
+}
+
+// Close closes the underlying file, if the reader was created with Open
+func (r *Reader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	r.closers = nil
+	return err
+}
+
+// Replay dispatches all frames of the recording to the session, see *session.Dispatch().
+// A speed of 1 keeps the original time between frames, 2 replays twice as fast,
+// and a speed <= 0 replays without waiting.
+func Replay(ctx context.Context, r *Reader, s *dggchat.Session, speed float64) error {
+	var previous time.Time
+	for {
+		f, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if speed > 0 && !previous.IsZero() {
+			wait := time.Duration(float64(f.Received.Sub(previous)) / speed)
+			if wait > 0 {
+				t := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return ctx.Err()
+				case <-t.C:
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		s.Dispatch(f.Bytes(), f.Received)
+		previous = f.Received
+	}
+}
+
+// ReplayFile opens the named recording and replays it, see Replay
+func ReplayFile(ctx context.Context, name string, s *dggchat.Session, speed float64) error {
+	r, err := Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return Replay(ctx, r, s, speed)
+}
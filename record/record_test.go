@@ -0,0 +1,132 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+var frames = []string{
+	`NAMES {"connectioncount":2,"users":[{"nick":"alice"},{"nick":"bob"}]}`,
+	`MSG {"nick":"alice","data":"hi","timestamp":1700000000000}`,
+	`MSG {"nick":`,
+	`MUTE {"nick":"mod","data":"bob","timestamp":1700000001000}`,
+	`ERR "throttled"`,
+}
+
+// capture returns the type and payload of every event received by the session
+func capture(s *dggchat.Session) *[]string {
+	var events []string
+	s.AddEventListener(func(e dggchat.Event, _ *dggchat.Session) {
+		events = append(events, e.Type+" "+e.Payload)
+	})
+	return &events
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"chat.jsonl", "chat.jsonl.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+
+			live, _ := dggchat.New()
+			recorded := capture(live)
+			rec, err := Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec.Attach(live)
+			start := time.Now()
+			for i, frame := range frames {
+				live.Dispatch([]byte(frame), start.Add(time.Duration(i)*time.Millisecond))
+			}
+			if err := rec.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// closing stops recording
+			live.Dispatch([]byte(`MSG {"nick":"alice","data":"late","timestamp":1}`), time.Now())
+
+			replayed, _ := dggchat.New()
+			events := capture(replayed)
+			var received []time.Time
+			replayed.AddEventListener(func(e dggchat.Event, _ *dggchat.Session) {
+				received = append(received, e.Received)
+			})
+			if err := ReplayFile(context.Background(), path, replayed, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*events, (*recorded)[:len(frames)]) {
+				t.Errorf("expected replayed events\n%q\ngot\n%q", (*recorded)[:len(frames)], *events)
+			}
+			for i, r := range received {
+				if !r.Equal(start.Add(time.Duration(i) * time.Millisecond)) {
+					t.Errorf("event %d: expected the recorded receive time, got %v", i, r)
+				}
+			}
+			if len(replayed.GetUsers()) != 2 {
+				t.Error("expected replaying to update the chat room state")
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(`{"type":"MSG","payload":"{}","time":"2024-01-01T00:00:00Z"}` + "\n\n  \n" +
+		`{"type":"PING","payload":"{}","time":"2024-01-01T00:00:01Z"}`))
+
+	var types []string
+	for {
+		f, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, f.Type)
+	}
+	if !reflect.DeepEqual(types, []string{"MSG", "PING"}) {
+		t.Errorf("unexpected frames %q", types)
+	}
+
+	if _, err := NewReader(strings.NewReader("not json\n")).Next(); err == nil {
+		t.Error("expected malformed lines to return an error")
+	}
+
+	f := Frame{Type: "MSG", Payload: `{"nick":"alice","data":"hi","timestamp":1}`}
+	e, err := f.Event()
+	if m, ok := e.Data.(dggchat.Message); err != nil || !ok || m.Message != "hi" {
+		t.Errorf("unexpected event %+v (%v)", e, err)
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	var b strings.Builder
+	rec := NewRecorder(&b)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_ = rec.Record(Frame{Type: "PING", Payload: `{"timestamp":1}`, Received: start.Add(time.Duration(i) * 100 * time.Millisecond)})
+	}
+
+	s, _ := dggchat.New()
+	began := time.Now()
+	if err := Replay(context.Background(), NewReader(strings.NewReader(b.String())), s, 2); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(began); took < 100*time.Millisecond {
+		t.Errorf("expected replaying at double speed to take 100ms, took %v", took)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Replay(ctx, NewReader(strings.NewReader(b.String())), s, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected replaying to stop when cancelled, got %v", err)
+	}
+}
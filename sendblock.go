@@ -0,0 +1,169 @@
+package dggchat
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// SendBlockedReason is the reason the session can not send chat messages
+type SendBlockedReason string
+
+// Reasons for not being able to send chat messages
+const (
+	// SendNotBlocked means the session can send messages, as far as it knows
+	SendNotBlocked SendBlockedReason = ""
+	// SendBlockedReadOnly means no login key was given
+	SendBlockedReadOnly SendBlockedReason = "readonly"
+	// SendBlockedNeedLogin means the server does not consider the session logged in
+	SendBlockedNeedLogin SendBlockedReason = "needlogin"
+	// SendBlockedBanned means our user is banned
+	SendBlockedBanned SendBlockedReason = "banned"
+	// SendBlockedMuted means our user is muted
+	SendBlockedMuted SendBlockedReason = "muted"
+	// SendBlockedSubOnly means subscriber only mode is active and our user is not allowed to talk
+	SendBlockedSubOnly SendBlockedReason = "submode"
+)
+
+// DefaultMuteDuration is the length of mutes the server uses if none is given.
+// It is assumed for mutes of our user the server did not send the duration of.
+const DefaultMuteDuration = 10 * time.Minute
+
+// sendState is what the session learned from the server about being able to send.
+// It is part of the chat room state and guarded by its lock.
+type sendState struct {
+	needLogin     bool
+	banned        bool
+	muted         bool
+	mutedUntil    time.Time
+	subOnly       bool
+	subOnlyDenied bool
+}
+
+// CanSend returns true if the session can send chat messages, as far as it knows.
+// See *session.SendBlockedReason() for why it can not.
+func (s *Session) CanSend() bool {
+	reason, _ := s.SendBlockedReason()
+	return reason == SendNotBlocked
+}
+
+// SendBlockedReason returns why the session can not send chat messages, and for mutes
+// the remaining duration if known, otherwise 0. Mutes of our user without a duration
+// are assumed to last DefaultMuteDuration.
+// The reason is learned from error messages of the server, and from mutes, bans and subscriber
+// only mode affecting our own user. Sending is not prevented, the server decides.
+func (s *Session) SendBlockedReason() (SendBlockedReason, time.Duration) {
+	s.RLock()
+	readOnly := s.readOnly
+	s.RUnlock()
+	if readOnly {
+		return SendBlockedReadOnly, 0
+	}
+
+	me, meKnown := s.state.getMe()
+
+	s.state.RLock()
+	defer s.state.RUnlock()
+	st := s.state.send
+
+	switch {
+	case st.needLogin:
+		return SendBlockedNeedLogin, 0
+	case st.banned:
+		return SendBlockedBanned, 0
+	case st.muted && (st.mutedUntil.IsZero() || time.Now().Before(st.mutedUntil)):
+		if st.mutedUntil.IsZero() {
+			return SendBlockedMuted, 0
+		}
+		return SendBlockedMuted, time.Until(st.mutedUntil)
+	case st.subOnlyDenied, st.subOnly && meKnown && !canTalkInSubOnly(me):
+		return SendBlockedSubOnly, 0
+	}
+	return SendNotBlocked, 0
+}
+
+// canTalkInSubOnly returns true if the user can send messages during subscriber only mode
+func canTalkInSubOnly(u User) bool {
+	return u.Role() >= RoleSubscriber || u.IsProtected() || u.IsBot()
+}
+
+// updateSendState applies changes to the ability to send caused by the event
+func (s *Session) updateSendState(e Event) {
+	me, meKnown := s.state.getMe()
+	isMe := func(u User) bool {
+		return meKnown && strings.EqualFold(u.Nick, me.Nick)
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	st := &s.state.send
+
+	switch data := e.Data.(type) {
+	case string:
+		if e.Type != "ERR" {
+			return
+		}
+		switch data {
+		case ErrorNeedLogin:
+			st.needLogin = true
+		case ErrorBanned:
+			st.banned = true
+		case ErrorMuted:
+			st.muted = true
+			var em errorMessage
+			if err := json.Unmarshal([]byte(e.Payload), &em); err == nil && em.MuteTimeLeft > 0 {
+				st.mutedUntil = e.Received.Add(time.Duration(em.MuteTimeLeft) * time.Second)
+			} else {
+				st.mutedUntil = e.Received.Add(DefaultMuteDuration)
+			}
+		case ErrorSubMode:
+			st.subOnlyDenied = true
+		}
+
+	case Message:
+		// the server echoes our own messages, so we were able to send
+		if isMe(data.Sender) {
+			*st = sendState{subOnly: st.subOnly}
+		}
+
+	case Mute:
+		if !isMe(data.Target) {
+			return
+		}
+		st.muted = e.Type == "MUTE"
+		st.mutedUntil = time.Time{}
+		if st.muted {
+			d := data.Duration
+			if d <= 0 {
+				d = DefaultMuteDuration
+			}
+			st.mutedUntil = e.Received.Add(d)
+		}
+
+	case Ban:
+		if !isMe(data.Target) {
+			return
+		}
+		st.banned = e.Type == "BAN"
+		if !st.banned {
+			// unbanning also removes mutes
+			st.muted = false
+			st.mutedUntil = time.Time{}
+		}
+
+	case SubOnly:
+		st.subOnly = data.Active
+		if !data.Active {
+			st.subOnlyDenied = false
+		}
+	}
+}
+
+// resetConnection forgets what was learned from a previous connection,
+// the server reports login problems and bans again when connecting.
+func (s *state) resetConnection() {
+	s.Lock()
+	defer s.Unlock()
+	s.send.needLogin = false
+	s.send.banned = false
+}
@@ -0,0 +1,98 @@
+package dggchat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendBlockedReason(t *testing.T) {
+	s, _ := New("key")
+	s.state.setMe(User{Nick: "bot"})
+	now := time.Now()
+
+	steps := []struct {
+		frame  string
+		reason SendBlockedReason
+	}{
+		{`MSG {"nick":"alice","data":"hi","timestamp":1}`, SendNotBlocked},
+		{`ERR "needlogin"`, SendBlockedNeedLogin},
+		{`MSG {"nick":"bot","data":"hi","timestamp":1}`, SendNotBlocked},
+		{`MUTE {"nick":"mod","data":"alice","timestamp":1}`, SendNotBlocked},
+		{`MUTE {"nick":"mod","data":"Bot","timestamp":1}`, SendBlockedMuted},
+		{`UNMUTE {"nick":"mod","data":"bot","timestamp":1}`, SendNotBlocked},
+		{`BAN {"nick":"mod","data":"bot","timestamp":1}`, SendBlockedBanned},
+		{`UNBAN {"nick":"mod","data":"bot","timestamp":1}`, SendNotBlocked},
+		{`SUBONLY {"nick":"mod","data":"on","timestamp":1}`, SendBlockedSubOnly},
+		{`SUBONLY {"nick":"mod","data":"off","timestamp":1}`, SendNotBlocked},
+		{`ERR "submode"`, SendBlockedSubOnly},
+		{`SUBONLY {"nick":"mod","data":"off","timestamp":1}`, SendNotBlocked},
+		{`ERR "banned"`, SendBlockedBanned},
+	}
+	for _, step := range steps {
+		s.Dispatch([]byte(step.frame), now)
+		if reason, _ := s.SendBlockedReason(); reason != step.reason {
+			t.Fatalf("after %s: expected reason %q, got %q", step.frame, step.reason, reason)
+		}
+		if s.CanSend() != (step.reason == SendNotBlocked) {
+			t.Fatalf("after %s: unexpected CanSend", step.frame)
+		}
+	}
+
+	s.state.resetConnection()
+	s.Dispatch([]byte(`ERR {"description":"muted","muteTimeLeft":600}`), now)
+	reason, left := s.SendBlockedReason()
+	if reason != SendBlockedMuted || left <= 9*time.Minute || left > 10*time.Minute {
+		t.Errorf("expected to be muted for 10 minutes, got %q for %v", reason, left)
+	}
+	s.Dispatch([]byte(`ERR {"description":"muted","muteTimeLeft":1}`), now.Add(-time.Minute))
+	if !s.CanSend() {
+		t.Error("expected expired mute not to block sending")
+	}
+
+	s.state.setMe(User{Nick: "bot", Features: []string{FeatureSubscriber}})
+	s.Dispatch([]byte(`SUBONLY {"nick":"mod","data":"on","timestamp":1}`), now)
+	if !s.CanSend() {
+		t.Error("expected subscribers to be able to send in sub only mode")
+	}
+
+	readOnly, _ := New()
+	if reason, _ := readOnly.SendBlockedReason(); reason != SendBlockedReadOnly {
+		t.Errorf("expected read-only reason, got %q", reason)
+	}
+}
+
+func TestMuteExpiry(t *testing.T) {
+	s, _ := New("key")
+	s.state.setMe(User{Nick: "bot"})
+	now := time.Now()
+
+	s.Dispatch([]byte(`MUTE {"nick":"mod","data":"bot","timestamp":1,"duration":60}`), now)
+	reason, left := s.SendBlockedReason()
+	if reason != SendBlockedMuted || left <= 50*time.Second || left > time.Minute {
+		t.Errorf("expected to be muted for a minute, got %q for %v", reason, left)
+	}
+	s.Dispatch([]byte(`MUTE {"nick":"mod","data":"bot","timestamp":1,"duration":60}`), now.Add(-2*time.Minute))
+	if !s.CanSend() {
+		t.Error("expected expired mute not to block sending")
+	}
+
+	s.Dispatch([]byte(`MUTE {"nick":"mod","data":"bot","timestamp":1}`), now)
+	reason, left = s.SendBlockedReason()
+	if reason != SendBlockedMuted || left <= DefaultMuteDuration-10*time.Second || left > DefaultMuteDuration {
+		t.Errorf("expected to be muted for the default duration, got %q for %v", reason, left)
+	}
+	s.Dispatch([]byte(`MUTE {"nick":"mod","data":"bot","timestamp":1}`), now.Add(-DefaultMuteDuration-time.Second))
+	if !s.CanSend() {
+		t.Error("expected mute without duration to expire after the default duration")
+	}
+
+	s.Dispatch([]byte(`ERR "muted"`), now)
+	reason, left = s.SendBlockedReason()
+	if reason != SendBlockedMuted || left <= DefaultMuteDuration-10*time.Second || left > DefaultMuteDuration {
+		t.Errorf("expected error without time left to mute for the default duration, got %q for %v", reason, left)
+	}
+	s.Dispatch([]byte(`ERR "muted"`), now.Add(-24*time.Hour))
+	if !s.CanSend() {
+		t.Error("expected mute error without time left to expire after the default duration")
+	}
+}
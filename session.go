@@ -1,13 +1,17 @@
 package dggchat
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -19,14 +23,26 @@ type Session struct {
 	// If true, attempt to reconnect on error
 	attempToReconnect bool
 
-	readOnly     bool
-	loginKey     string
-	originHeader string
-	wsURL        url.URL
-	ws           *websocket.Conn
-	handlers     handlers
-	state        *state
-	dialer       *websocket.Dialer
+	readOnly        bool
+	loginKey        string
+	sid             string
+	rememberMe      string
+	backend         Backend
+	apiURLSet       bool
+	ws              *websocket.Conn
+	handlers        handlers
+	state           *state
+	dialer          *websocket.Dialer
+	httpClient      *http.Client
+	header          http.Header
+	mentionKeywords []*regexp.Regexp
+	sendInterval    time.Duration
+	lastSend        time.Time
+	duplicatePolicy DuplicatePolicy
+	lastMessage     lastMessage
+	listeners       listeners
+	observer        Observer
+	logger          atomic.Pointer[slog.Logger]
 }
 
 type messageOut struct {
@@ -38,9 +54,11 @@ type privateMessageOut struct {
 	Data string `json:"data"`
 }
 
+// The server reads the duration of mutes and bans as a time.Duration, so unlike the
+// seconds of the MUTE and BAN messages it sends, durations are sent in nanoseconds.
 type muteOut struct {
 	Data     string `json:"data"`
-	Duration int64  `data:"duration,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
 }
 
 type banOut struct {
@@ -59,20 +77,22 @@ type pingOut struct {
 // on a websocket that is already open.
 var ErrAlreadyOpen = errors.New("web socket is already open")
 
+// ErrNotConnected is thrown when attempting to send without an open connection
+var ErrNotConnected = errors.New("connection not established")
+
 // ErrReadOnly is thrown when attempting to send messages using a read-only session.
 var ErrReadOnly = errors.New("session is read-only")
 
-var wsURL = url.URL{Scheme: "wss", Host: "www.destiny.gg", Path: "/ws"}
-
 // SetURL changes the url that will be used when connecting to the socket server.
 // This should be done before calling *session.Open()
 func (s *Session) SetURL(u url.URL) {
 	s.Lock()
 	defer s.Unlock()
-	s.wsURL = u
+	s.backend.URL = u
 }
 
 // SetDialer changes the websocket dialer that will be used when connecting to the socket server.
+// This replaces the proxy and tls config set for the websocket connection.
 func (s *Session) SetDialer(d websocket.Dialer) {
 	s.Lock()
 	defer s.Unlock()
@@ -82,6 +102,10 @@ func (s *Session) SetDialer(d websocket.Dialer) {
 // Open opens a websocket connection to destinygg chat.
 func (s *Session) Open() error {
 
+	if err := s.lookupMe(false); err != nil {
+		return err
+	}
+
 	s.Lock()
 	defer s.Unlock()
 
@@ -103,28 +127,68 @@ func (s *Session) open() error {
 	}
 
 	header := http.Header{}
-	if strings.TrimSpace(s.originHeader) != "" {
-		_, err := url.ParseRequestURI(s.originHeader)
+	for k, v := range s.header {
+		header[k] = append([]string(nil), v...)
+	}
+	if strings.TrimSpace(s.backend.Origin) != "" {
+		_, err := url.ParseRequestURI(s.backend.Origin)
 		if err != nil {
 			return err
 		}
-		header.Add("Origin", s.originHeader)
+		header.Add("Origin", s.backend.Origin)
 	}
 	if !s.readOnly {
-		header.Add("Cookie", fmt.Sprintf("authtoken=%s", s.loginKey))
+		header.Add("Cookie", s.authCookie())
 	}
 
-	ws, _, err := s.dialer.Dial(s.wsURL.String(), header)
+	s.log().Info("connecting to chat", "url", s.backend.URL.String(), "readOnly", s.readOnly)
+	s.log().Debug("websocket handshake", "header", redactHeader(header))
+	ws, resp, err := s.dialer.Dial(s.backend.URL.String(), header)
 	if err != nil {
-		return err
+		s.log().Warn("could not connect to chat", "url", s.backend.URL.String(), "error", err)
+		return &DialError{URL: s.backend.URL.String(), Response: resp, Err: err}
 	}
 	s.ws = ws
+	s.state.resetConnection()
+	s.log().Info("connected to chat", "url", s.backend.URL.String())
 
-	go s.listen()
+	go s.listen(ws)
 
 	return nil
 }
 
+// lookupMe learns who we are logged in as, if not known yet or refresh is set. It is called
+// before taking the session lock, as the request may take a while.
+// Failing to do so is not fatal unless the login is rejected, but an unknown user stays unknown,
+// as the users of NAMES and JOIN messages can not be told apart without our nick.
+func (s *Session) lookupMe(refresh bool) error {
+	s.RLock()
+	readOnly, trusted := s.readOnly, s.apiTrusted()
+	s.RUnlock()
+	if readOnly {
+		return nil
+	}
+	if !trusted {
+		s.log().Debug("not looking up own user, the api is not on the host of the chat")
+		return nil
+	}
+	if _, ok := s.state.getMe(); ok && !refresh {
+		return nil
+	}
+
+	me, err := s.fetchMe(context.Background())
+	switch {
+	case err == nil:
+		s.state.setMe(me)
+	case errors.Is(err, ErrAuthFailed):
+		s.log().Warn("login rejected by the chat api")
+		return err
+	default:
+		s.log().Warn("could not look up own user", "error", err)
+	}
+	return nil
+}
+
 // Close cleanly closes the connection and stops running listeners
 func (s *Session) Close() error {
 
@@ -144,205 +208,136 @@ func (s *Session) Close() error {
 	}
 
 	s.ws = nil
+	s.log().Info("connection to chat closed")
 	return nil
 }
 
 func (s *Session) reconnect() {
 
 	wait := 1
-	for {
+	for attempt := 1; ; attempt++ {
+		s.log().Info("reconnecting to chat", "attempt", attempt)
+		// the login may have been revoked, or our user changed if the server asked us to refresh
+		err := s.lookupMe(true)
 		s.Lock()
-		err := s.open()
+		if err == nil {
+			err = s.open()
+		}
+		if s.observer != nil {
+			s.observer.ObserveReconnect(err)
+		}
 		s.Unlock()
 
 		if err == nil {
 			return
 		}
+		// retrying does not help if the login is rejected
+		if errors.Is(err, ErrAuthFailed) {
+			s.log().Error("login rejected, giving up reconnecting", "attempt", attempt)
+			return
+		}
 
 		wait *= 2
 		if wait > 32 {
 			wait = 32
 		}
+		s.log().Warn("reconnect failed", "attempt", attempt, "retryIn", time.Duration(wait)*time.Second, "error", err)
 		time.Sleep(time.Duration(wait) * time.Second)
 	}
 }
 
-func (s *Session) listen() {
+func (s *Session) listen(ws *websocket.Conn) {
 	for {
-		_, message, err := s.ws.ReadMessage()
+		_, message, err := ws.ReadMessage()
 		if err != nil {
+			s.log().Info("connection to chat lost", "error", err)
 			if s.handlers.socketErrorHandler != nil {
 				s.handlers.socketErrorHandler(err, s)
 			}
-			if s.attempToReconnect {
+			s.RLock()
+			attempToReconnect := s.attempToReconnect
+			s.RUnlock()
+			if attempToReconnect {
 				s.reconnect()
 			}
 			return
 		}
 
-		mslice := strings.SplitN(string(message[:]), " ", 2)
-		if len(mslice) != 2 {
-			continue
-		}
-
-		mType := mslice[0]
-		mContent := mslice[1]
+		mType := s.Dispatch(message, time.Now())
 
-		switch mType {
-
-		case "MSG":
-			m, err := parseMessage(mContent)
-			if s.handlers.msgHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.msgHandler(m, s)
-
-		case "PIN":
-			pin, err := parsePin(mContent)
-			if s.handlers.pinHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.pinHandler(pin, s)
-
-		case "SUBSCRIPTION", "GIFTSUB", "MASSGIFT":
-			sub, err := parseSubscription(mContent)
-			if s.handlers.subscriptionHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.subscriptionHandler(sub, s)
-
-		case "DONATION":
-			dono, err := parseDonation(mContent)
-			if s.handlers.donationHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.donationHandler(dono, s)
-
-		case "MUTE":
-			mute, err := parseMute(mContent, s)
-			if s.handlers.muteHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.muteHandler(mute, s)
-
-		case "UNMUTE":
-			mute, err := parseMute(mContent, s)
-			if s.handlers.muteHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.unmuteHandler(mute, s)
-
-		case "BAN":
-			ban, err := parseBan(mContent, s)
-			if s.handlers.banHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.banHandler(ban, s)
-
-		case "UNBAN":
-			ban, err := parseBan(mContent, s)
-			if s.handlers.banHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.unbanHandler(ban, s)
-
-		case "SUBONLY":
-			so, err := parseSubOnly(mContent)
-			if s.handlers.subOnlyHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.subOnlyHandler(so, s)
-
-		case "BROADCAST":
-			b, err := parseBroadcast(mContent)
-			if s.handlers.broadcastHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.broadcastHandler(b, s)
-
-		case "PRIVMSG":
-			pm, err := parsePrivateMessage(mContent, s)
-			if s.handlers.pmHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.pmHandler(pm, s)
-
-		case "PRIVMSGSENT":
-			// confirms sending of a PM was successful.
-			// If not successful, an ERR message is sent anyways. Ignore this.
-		case "PING":
-		case "PONG":
-			p, err := parsePing(mContent)
-			if s.handlers.pingHandler == nil || err != nil {
-				continue
-			}
-			s.handlers.pingHandler(p, s)
-
-		case "ERR":
-			if s.handlers.errHandler == nil {
-				continue
-			}
-			errMessage := parseErrorMessage(mContent)
-			s.handlers.errHandler(errMessage, s)
-
-		case "NAMES":
-			n, err := parseNames(mContent)
-			if err != nil {
-				continue
-			}
-			s.state.Lock()
-			s.state.users = n.Users
-			s.state.Unlock()
-
-			if s.handlers.namesHandler != nil {
-				s.handlers.namesHandler(n, s)
-			}
-
-		case "JOIN":
-			ra, err := parseRoomAction(mContent)
-			if err != nil {
-				continue
-			}
-
-			s.state.addUser(ra.User)
-
-			if s.handlers.joinHandler != nil {
-				s.handlers.joinHandler(ra, s)
-			}
-
-		case "QUIT":
-			ra, err := parseRoomAction(mContent)
-			if err != nil {
-				continue
-			}
+		if mType == "REFRESH" {
+			s.log().Info("reconnecting to refresh user information")
+			// This message is received immediately before the server closes the
+			// connection because user information was changed, and we need to reinitialize.
+			s.reconnect()
+			return
+		}
+	}
+}
 
-			s.state.removeUser(ra.User.Nick)
+// Dispatch handles a raw protocol message, e.g. `MSG {"nick":...}`, as if it was received
+// from the server at the given time: the chat room state is updated, and listeners and
+// handlers are called. This can be used to replay recorded messages without a connection.
+// Returns the type of the message, or an empty string if it is malformed.
+func (s *Session) Dispatch(frame []byte, received time.Time) string {
+	mType, mContent, ok := splitFrame(frame)
+	if !ok {
+		s.log().Warn("received malformed frame", "frame", string(frame))
+		return ""
+	}
+	s.log().Debug("received frame", "type", mType, "payload", mContent)
 
-			if s.handlers.quitHandler != nil {
-				s.handlers.quitHandler(ra, s)
-			}
+	e := Event{
+		Type:     mType,
+		Payload:  mContent,
+		Received: received,
+	}
+	e.Data, e.Err = parseEvent(mType, mContent, s)
+	if e.Err != nil {
+		s.log().Warn("could not parse frame", "type", mType, "payload", mContent, "error", e.Err)
+		e.Data = nil
+	} else {
+		s.updateState(e)
+	}
 
-		case "UPDATEUSER":
-			u, err := parseUpdateUser(mContent)
-			if err != nil {
-				continue
-			}
+	s.emit(e)
+	if e.Err == nil {
+		start := time.Now()
+		s.callHandler(e)
+		if o := s.Observer(); o != nil {
+			o.ObserveHandler(mType, time.Since(start))
+		}
+	}
 
-			s.state.updateUser(u)
+	return mType
+}
 
-			if s.handlers.userUpdateHandler != nil {
-				s.handlers.userUpdateHandler(u, s)
-			}
+// updateState applies changes to the chat room state caused by the event
+func (s *Session) updateState(e Event) {
+	switch data := e.Data.(type) {
+	case Names:
+		s.state.Lock()
+		s.state.users = data.Users
+		s.state.Unlock()
 
-		case "REFRESH":
-			// This message is received immediately before the server closes the
-			// connection because user information was changed, and we need to reinitialize.
+		for _, u := range data.Users {
+			s.state.refreshMe(u)
+		}
 
-			// TODO possibly add an eventhandler here
-			s.reconnect()
+	case RoomAction:
+		if e.Type == "QUIT" {
+			s.state.removeUser(data.User.Nick)
 			return
 		}
+		s.state.addUser(data.User)
+		s.state.refreshMe(data.User)
+
+	case User:
+		s.state.updateUser(data)
+		s.state.refreshMe(data)
 	}
+
+	s.updateSendState(e)
 }
 
 // GetUser attempts to find the user in the chat room state.
@@ -361,6 +356,53 @@ func (s *Session) GetUser(name string) (User, bool) {
 	return User{}, false
 }
 
+// Me returns the user the session is logged in as.
+// The user is looked up when opening the connection, and kept up to date
+// from NAMES, JOIN and UPDATEUSER messages. If the session is read-only or the
+// user could not be determined yet, false is returned as the second parameter.
+func (s *Session) Me() (User, bool) {
+	return s.state.getMe()
+}
+
+// SetMentionKeywords sets a list of additional words or phrases that, besides
+// our own nick, cause a message to be passed to the mention handler.
+func (s *Session) SetMentionKeywords(keywords ...string) {
+	patterns := make([]*regexp.Regexp, 0, len(keywords))
+	for _, keyword := range keywords {
+		if re := mentionPattern(keyword); re != nil {
+			patterns = append(patterns, re)
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.mentionKeywords = patterns
+}
+
+// isMention reports whether m highlights our own nick or one of the mention keywords.
+// Our own messages are never considered mentions.
+func (s *Session) isMention(m Message) bool {
+	me, ok := s.state.getMe()
+	if ok {
+		if strings.EqualFold(m.Sender.Nick, me.Nick) {
+			return false
+		}
+		if s.state.mentionsMe(m) {
+			return true
+		}
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+	for _, re := range s.mentionKeywords {
+		if re.MatchString(m.Message) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // GetUsers returns a list of users currently online
 func (s *Session) GetUsers() []User {
 	s.state.RLock()
@@ -370,59 +412,127 @@ func (s *Session) GetUsers() []User {
 	return u
 }
 
+// SetSendInterval sets the minimum time between two messages sent to the server.
+// Sending blocks until the interval has passed since the previous message.
+// An interval of 0, the default, disables waiting.
+func (s *Session) SetSendInterval(interval time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.sendInterval = interval
+}
+
+// reserveSend reserves the time to send the next message, at least interval (or the session's
+// send interval if it is longer) after the previous one, and returns how long to wait for it.
+// Waiting is done without holding the lock, concurrent senders get consecutive times.
+// call with locks held
+func (s *Session) reserveSend(interval time.Duration) time.Duration {
+	if interval < s.sendInterval {
+		interval = s.sendInterval
+	}
+	now := time.Now()
+	next := s.lastSend.Add(interval)
+	if next.Before(now) {
+		next = now
+	}
+	s.lastSend = next
+	return next.Sub(now)
+}
+
 func (s *Session) send(message interface{}, mType string) error {
-	if s.readOnly {
+	return s.sendWithInterval(message, mType, 0)
+}
+
+// sendWithInterval sends the message, waiting at least interval (or the session's
+// send interval if it is longer) since the previous message was sent.
+func (s *Session) sendWithInterval(message interface{}, mType string, interval time.Duration) error {
+	s.RLock()
+	readOnly, backend := s.readOnly, s.backend
+	s.RUnlock()
+	if readOnly {
 		return ErrReadOnly
 	}
+	if !backend.Supports(mType) {
+		return ErrUnsupported
+	}
 	m, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
 
+	s.Lock()
+	if s.ws == nil {
+		s.Unlock()
+		return ErrNotConnected
+	}
+	wait := s.reserveSend(interval)
+	s.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+
 	s.Lock()
 	defer s.Unlock()
-	// Close() might have been called for some reason, this prevents panicing in those cases
+	// Close() might have been called while waiting, this prevents panicing in those cases
 	if s.ws == nil {
-		return errors.New("connection not established")
+		return ErrNotConnected
 	}
-	return s.ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%s %s", mType, m)))
+	s.log().Debug("sending frame", "type", mType, "payload", string(m))
+	err = s.ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%s %s", mType, m)))
+	if err != nil {
+		s.log().Warn("could not send frame", "type", mType, "error", err)
+	}
+	if s.observer != nil {
+		s.observer.ObserveSend(mType, err)
+	}
+	return err
 }
 
 // SendMessage sends the given string as a message to chat.
+// Repeated messages are handled according to the duplicate policy, see SetDuplicatePolicy.
 // Note: a return error of nil does not guarantee successful delivery.
 // Monitor for error events to ensure the message was sent with no errors.
 func (s *Session) SendMessage(message string) error {
-	m := messageOut{Data: message}
-	return s.send(m, "MSG")
+	return s.sendChatMessage(message, 0)
 }
 
 // SendMute mutes the user with the given nick.
+// Returns an error without sending if the session is not allowed to, see *session.Can().
 // If duration is <= 0, the server uses its built-in default duration
 func (s *Session) SendMute(nick string, duration time.Duration) error {
+	if err := s.Can(ActionMute, nick); err != nil {
+		return err
+	}
 	m := muteOut{Data: nick}
 	if duration > 0 {
-		m.Duration = int64(duration)
+		m.Duration = duration.Nanoseconds()
 	}
 	return s.send(m, "MUTE")
 }
 
 // SendUnmute unmutes the user with the given nick.
 func (s *Session) SendUnmute(nick string) error {
+	if err := s.Can(ActionUnmute, nick); err != nil {
+		return err
+	}
 	m := messageOut{Data: nick}
 	return s.send(m, "UNMUTE")
 }
 
 // SendBan bans the user with the given nick.
+// Returns an error without sending if the session is not allowed to, see *session.Can().
 // Bans require a ban reason to be specified.
 // If duration is <= 0, the server uses its built-in default duration
 func (s *Session) SendBan(nick string, reason string, duration time.Duration, banip bool) error {
+	if err := s.Can(ActionBan, nick); err != nil {
+		return err
+	}
 	b := banOut{
 		Nick:   nick,
 		Reason: reason,
 		Banip:  banip,
 	}
 	if duration > 0 {
-		b.Duration = int64(duration)
+		b.Duration = duration.Nanoseconds()
 	}
 	return s.send(b, "BAN")
 }
@@ -430,6 +540,9 @@ func (s *Session) SendBan(nick string, reason string, duration time.Duration, ba
 // SendPermanentBan bans the user with the given nick permanently.
 // Bans require a ban reason to be specified.
 func (s *Session) SendPermanentBan(nick string, reason string, banip bool) error {
+	if err := s.Can(ActionBan, nick); err != nil {
+		return err
+	}
 	b := banOut{
 		Nick:        nick,
 		Reason:      reason,
@@ -442,6 +555,9 @@ func (s *Session) SendPermanentBan(nick string, reason string, banip bool) error
 // SendUnban unbans the user with the given nick.
 // Unbanning also removes mutes.
 func (s *Session) SendUnban(nick string) error {
+	if err := s.Can(ActionUnban, nick); err != nil {
+		return err
+	}
 	b := messageOut{Data: nick}
 	return s.send(b, "UNBAN")
 }
@@ -465,6 +581,9 @@ func (s *Session) SendPrivateMessage(nick string, message string) error {
 // SendSubOnly modifies the chat subonly mode.
 // During subonly mode, only subscribers and some other special user classes are allowed to send messages.
 func (s *Session) SendSubOnly(subonly bool) error {
+	if err := s.Can(ActionSubOnly, ""); err != nil {
+		return err
+	}
 	data := "off"
 	if subonly {
 		data = "on"
@@ -475,6 +594,9 @@ func (s *Session) SendSubOnly(subonly bool) error {
 
 // SendBroadcast sends a broadcast message to chat
 func (s *Session) SendBroadcast(message string) error {
+	if err := s.Can(ActionBroadcast, ""); err != nil {
+		return err
+	}
 	b := messageOut{Data: message}
 	return s.send(b, "BROADCAST")
 }
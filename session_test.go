@@ -0,0 +1,196 @@
+package dggchat
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// noopHandlers adds handlers for every event type, so fuzzing reaches every handler call
+func noopHandlers(s *Session) {
+	s.AddMessageHandler(func(Message, *Session) {})
+	s.AddMentionHandler(func(Message, *Session) {})
+	s.AddPinHandler(func(Pin, *Session) {})
+	s.AddNamesHandler(func(Names, *Session) {})
+	s.AddMuteHandler(func(Mute, *Session) {})
+	s.AddUnmuteHandler(func(Mute, *Session) {})
+	s.AddBanHandler(func(Ban, *Session) {})
+	s.AddUnbanHandler(func(Ban, *Session) {})
+	s.AddErrorHandler(func(string, *Session) {})
+	s.AddJoinHandler(func(RoomAction, *Session) {})
+	s.AddQuitHandler(func(RoomAction, *Session) {})
+	s.AddUserUpdateHandler(func(User, *Session) {})
+	s.AddPMHandler(func(PrivateMessage, *Session) {})
+	s.AddBroadcastHandler(func(Broadcast, *Session) {})
+	s.AddSubscriptionHandler(func(Subscription, *Session) {})
+	s.AddDonationHandler(func(Donation, *Session) {})
+	s.AddPingHandler(func(Ping, *Session) {})
+	s.AddSubOnlyHandler(func(SubOnly, *Session) {})
+}
+
+// FuzzDispatch makes sure no message received from the server can panic the read loop
+func FuzzDispatch(f *testing.F) {
+	for _, frame := range readFrames(f) {
+		f.Add(frame)
+	}
+	f.Add([]byte("REFRESH"))
+	f.Add([]byte("MSG null"))
+	f.Add([]byte("NAMES {\"users\":null}"))
+
+	s, _ := New()
+	s.SetMentionKeywords("chat")
+	noopHandlers(s)
+	s.AddEventListener(func(Event, *Session) {})
+
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		s.Dispatch(frame, time.Now())
+	})
+}
+
+func TestDispatchState(t *testing.T) {
+	frames := readFrames(t)
+	s, _ := New()
+	s.state.setMe(User{Nick: "alice"})
+
+	s.Dispatch(frames["names"], time.Now())
+	if n := len(s.GetUsers()); n != 3 {
+		t.Fatalf("expected 3 users after NAMES, got %d", n)
+	}
+	if me, _ := s.Me(); me.ID != 42013 {
+		t.Errorf("expected own user to be refreshed from NAMES, got %+v", me)
+	}
+
+	s.Dispatch(frames["quit"], time.Now())
+	if _, ok := s.GetUser("alice"); ok {
+		t.Error("expected alice to be removed after QUIT")
+	}
+
+	s.Dispatch(frames["join"], time.Now())
+	if _, ok := s.GetUser("ALICE"); !ok {
+		t.Error("expected alice to be added after JOIN")
+	}
+}
+
+func TestMentionHandler(t *testing.T) {
+	s, _ := New()
+	s.state.setMe(User{Nick: "destiny"})
+	s.SetMentionKeywords("pepelaugh")
+
+	var mentions []string
+	s.AddMentionHandler(func(m Message, _ *Session) {
+		mentions = append(mentions, m.Message)
+	})
+
+	frames := []string{
+		`MSG {"nick":"alice","timestamp":1,"data":"hi destiny"}`,
+		`MSG {"nick":"alice","timestamp":1,"data":"destinyy"}`,
+		`MSG {"nick":"alice","timestamp":1,"data":"PepeLaugh"}`,
+		`MSG {"nick":"Destiny","timestamp":1,"data":"it's me, destiny"}`,
+	}
+	for _, frame := range frames {
+		s.Dispatch([]byte(frame), time.Now())
+	}
+
+	if len(mentions) != 2 || mentions[0] != "hi destiny" || mentions[1] != "PepeLaugh" {
+		t.Errorf("unexpected mentions %q", mentions)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	s, _ := NewWithOptions(
+		WithLoginKey("secret"),
+		WithLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+
+	s.Dispatch([]byte(`MSG {"nick":"alice","timestamp":1,"data":"hi"}`), time.Now())
+	s.Dispatch([]byte(`MSG {"nick":`), time.Now())
+
+	logs := buf.String()
+	if !strings.Contains(logs, "level=DEBUG msg=\"received frame\" type=MSG") {
+		t.Errorf("expected received frame to be logged, got:\n%s", logs)
+	}
+	if !strings.Contains(logs, "level=WARN msg=\"could not parse frame\" type=MSG") {
+		t.Errorf("expected parse failure to be logged, got:\n%s", logs)
+	}
+
+	h := redactHeader(http.Header{"Cookie": {"authtoken=secret"}, "Origin": {"https://www.destiny.gg"}})
+	if h.Get("Cookie") != redacted || h.Get("Origin") != "https://www.destiny.gg" {
+		t.Errorf("unexpected redacted header %v", h)
+	}
+}
+
+func TestWithLoginKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		readOnly bool
+	}{
+		{"no options", nil, true},
+		{"key", []Option{WithLoginKey("key")}, false},
+		{"empty key", []Option{WithLoginKey("")}, true},
+		{"empty key after cookie", []Option{WithSessionCookie("sid", ""), WithLoginKey("")}, false},
+	}
+	for _, tt := range tests {
+		s, _ := NewWithOptions(tt.opts...)
+		if reason, _ := s.SendBlockedReason(); (reason == SendBlockedReadOnly) != tt.readOnly {
+			t.Errorf("%s: expected read-only %v, got reason %q", tt.name, tt.readOnly, reason)
+		}
+	}
+}
+
+func TestModerationFrames(t *testing.T) {
+	frames := make(chan string, 10)
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			_, b, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames <- string(b)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	u.Scheme, u.Path = "ws", "/ws"
+
+	s, _ := NewWithOptions(WithLoginKey("key"), WithBackend(ChatGo(*u)))
+	s.state.setMe(User{Nick: "mod", Features: []string{FeatureModerator}})
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name  string
+		send  func() error
+		frame string
+	}{
+		{"mute", func() error { return s.SendMute("alice", time.Minute) }, `MUTE {"data":"alice","duration":60000000000}`},
+		{"default mute", func() error { return s.SendMute("alice", 0) }, `MUTE {"data":"alice"}`},
+		{"ban", func() error { return s.SendBan("alice", "spam", time.Hour, false) }, `BAN {"nick":"alice","reason":"spam","duration":3600000000000,"ispermanent":false}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(); err != nil {
+				t.Fatal(err)
+			}
+			if frame := <-frames; frame != tt.frame {
+				t.Errorf("expected frame %s, got %s", tt.frame, frame)
+			}
+		})
+	}
+}
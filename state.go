@@ -1,6 +1,7 @@
 package dggchat
 
 import (
+	"regexp"
 	"strings"
 	"sync"
 )
@@ -8,6 +9,10 @@ import (
 type state struct {
 	sync.RWMutex
 	users []User
+	me    *User
+	// mePattern matches mentions of our nick
+	mePattern *regexp.Regexp
+	send      sendState
 }
 
 func (s *state) removeUser(nick string) {
@@ -50,6 +55,43 @@ func (s *state) updateUser(user User) {
 	}
 }
 
+func (s *state) getMe() (User, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.me == nil {
+		return User{}, false
+	}
+	return *s.me, true
+}
+
+func (s *state) setMe(user User) {
+	s.Lock()
+	defer s.Unlock()
+	s.me = &user
+	s.mePattern = mentionPattern(user.Nick)
+}
+
+// mentionsMe returns true if the message mentions our nick
+func (s *state) mentionsMe(m Message) bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.mePattern != nil && s.mePattern.MatchString(m.Message)
+}
+
+// refreshMe replaces our own user with the given user if the nicks match.
+// This picks up information like the ID and creation date that are not
+// available when first looking up our user. If our user is not known,
+// nothing is changed.
+func (s *state) refreshMe(user User) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.me != nil && strings.EqualFold(s.me.Nick, user.Nick) {
+		s.me = &user
+	}
+}
+
 func newState() *state {
 	s := &state{
 		users: make([]User, 0),
@@ -0,0 +1,113 @@
+package dggchat
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// DialError is returned when the connection to the chat server could not be established
+type DialError struct {
+	URL string
+	// Response is the response to the websocket handshake, if the server sent one.
+	// Its body contains the start of the response body, e.g. to see why the server returned 403.
+	Response *http.Response
+	Err      error
+}
+
+func (e *DialError) Error() string {
+	if e.Response != nil {
+		return fmt.Sprintf("could not connect to %s: %v (status %s)", e.URL, e.Err, e.Response.Status)
+	}
+	return fmt.Sprintf("could not connect to %s: %v", e.URL, e.Err)
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// SetProxy makes the session connect through the given proxy, both to the chat and the http api.
+// Supported schemes are http, https and socks5. A nil url connects directly.
+// This should be done before calling *session.Open(), and after *session.SetDialer().
+func (s *Session) SetProxy(u *url.URL) {
+	s.Lock()
+	defer s.Unlock()
+
+	var proxy func(*http.Request) (*url.URL, error)
+	if u != nil {
+		proxy = http.ProxyURL(u)
+	}
+	d := *s.dialer
+	d.Proxy = proxy
+	s.dialer = &d
+	s.transport().Proxy = proxy
+}
+
+// SetTLSConfig sets the tls config used to connect to the chat and the http api,
+// e.g. to trust the certificate of a self-hosted chat.
+// This should be done before calling *session.Open(), and after *session.SetDialer().
+func (s *Session) SetTLSConfig(c *tls.Config) {
+	s.Lock()
+	defer s.Unlock()
+
+	d := *s.dialer
+	d.TLSClientConfig = c
+	s.dialer = &d
+	s.transport().TLSClientConfig = c
+}
+
+// SetHeader sets a header sent when connecting to the chat and with requests to the http api,
+// e.g. "User-Agent". An empty value removes the header.
+// The origin and cookie headers are set by the session.
+func (s *Session) SetHeader(key string, value string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.header == nil {
+		s.header = http.Header{}
+	}
+	if value == "" {
+		s.header.Del(key)
+		return
+	}
+	s.header.Set(key, value)
+}
+
+// transport returns the transport of the http client of the session,
+// replacing the shared default client with one of its own on first use.
+// call with locks held
+func (s *Session) transport() *http.Transport {
+	if t, ok := s.httpClient.Transport.(*http.Transport); ok && s.httpClient != http.DefaultClient {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	s.httpClient = &http.Client{Transport: t}
+	return t
+}
+
+// WithProxy makes the session connect through the given proxy, see *session.SetProxy()
+func WithProxy(u *url.URL) Option {
+	return func(s *Session) {
+		s.SetProxy(u)
+	}
+}
+
+// WithTLSConfig sets the tls config of the session, see *session.SetTLSConfig()
+func WithTLSConfig(c *tls.Config) Option {
+	return func(s *Session) {
+		s.SetTLSConfig(c)
+	}
+}
+
+// WithHeader sets a header sent by the session, see *session.SetHeader()
+func WithHeader(key string, value string) Option {
+	return func(s *Session) {
+		s.SetHeader(key, value)
+	}
+}
+
+// WithUserAgent sets the user agent sent by the session
+func WithUserAgent(userAgent string) Option {
+	return WithHeader("User-Agent", userAgent)
+}
@@ -0,0 +1,92 @@
+package dggchat
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDialError(t *testing.T) {
+	var userAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	u.Scheme = "ws"
+	s, _ := NewWithOptions(WithBackend(ChatGo(*u)), WithUserAgent("dggchat-test"))
+
+	err := s.Open()
+	var de *DialError
+	if !errors.As(err, &de) || de.Response == nil || de.Response.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a dial error with the handshake response, got %v", err)
+	}
+	if userAgent != "dggchat-test" {
+		t.Errorf("expected user agent to be sent, got %q", userAgent)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	var upgrader websocket.Upgrader
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	u.Scheme = "wss"
+
+	s, _ := NewWithOptions(WithBackend(ChatGo(*u)))
+	if err := s.Open(); err == nil {
+		t.Fatal("expected connecting to a server with an unknown certificate to fail")
+	}
+
+	pool := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	s, _ = NewWithOptions(WithBackend(ChatGo(*u)), WithTLSConfig(&tls.Config{RootCAs: pool}))
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if websocket.DefaultDialer.TLSClientConfig != nil || http.DefaultClient.Transport != nil {
+		t.Error("expected shared defaults not to be modified")
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var host string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.URL.Host
+		_, _ = w.Write([]byte(`{"nick":"alice"}`))
+	}))
+	defer proxy.Close()
+
+	p, _ := url.Parse(proxy.URL)
+	s, _ := NewWithOptions(WithLoginKey("key"), WithProxy(p))
+	s.SetAPIURL(url.URL{Scheme: "http", Host: "chat.example"})
+
+	me, err := s.fetchMe(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "chat.example" || me.Nick != "alice" {
+		t.Errorf("expected request through proxy, got host %q and user %+v", host, me)
+	}
+}